@@ -33,10 +33,11 @@ const (
 // ABEID defines the public interface for Kopano AB EntryIDs.
 type ABEID interface {
 	ABFlags() byte
-	GUID() [16]byte
+	GUID() GUID
 	Type() MAPIType
 	ID() uint32
 	ExID() []byte
+	Bytes() []byte
 	String() string
 	Hex() string
 }
@@ -54,7 +55,7 @@ func (abeid *abeidV1) ABFlags() byte {
 }
 
 // GUID returns the associated ABEID GUID value.
-func (abeid *abeidV1) GUID() [16]byte {
+func (abeid *abeidV1) GUID() GUID {
 	return abeid.header.GUID
 }
 
@@ -73,29 +74,24 @@ func (abeid *abeidV1) ExID() []byte {
 	return abeid.exID
 }
 
-func (abeid *abeidV1) String() string {
+// Bytes returns the associated ABEID's binary representation.
+func (abeid *abeidV1) Bytes() []byte {
 	buf := new(bytes.Buffer)
-	enc1 := base64.NewEncoder(base64.StdEncoding, buf)
-	binary.Write(enc1, binary.LittleEndian, abeid.header)
-	binary.Write(enc1, binary.LittleEndian, abeid.dataV1)
-	enc2 := base64.NewEncoder(base64.StdEncoding, enc1)
-	enc2.Write(abeid.exID)
-	enc2.Close()
-	enc1.Close()
+	binary.Write(buf, binary.LittleEndian, abeid.header)
+	binary.Write(buf, binary.LittleEndian, abeid.dataV1)
+	enc := base64.NewEncoder(base64.StdEncoding, buf)
+	enc.Write(abeid.exID)
+	enc.Close()
 
-	return buf.String()
+	return buf.Bytes()
 }
 
-func (abeid *abeidV1) Hex() string {
-	buf := new(bytes.Buffer)
-	enc1 := hex.NewEncoder(buf)
-	binary.Write(enc1, binary.LittleEndian, abeid.header)
-	binary.Write(enc1, binary.LittleEndian, abeid.dataV1)
-	enc2 := base64.NewEncoder(base64.StdEncoding, enc1)
-	enc2.Write(abeid.exID)
-	enc2.Close()
+func (abeid *abeidV1) String() string {
+	return base64.StdEncoding.EncodeToString(abeid.Bytes())
+}
 
-	return buf.String()
+func (abeid *abeidV1) Hex() string {
+	return hex.EncodeToString(abeid.Bytes())
 }
 
 // A abeidHeader is the byte representation of an AB EntryID start including
@@ -104,7 +100,7 @@ func (abeid *abeidV1) Hex() string {
 // for the basic EntryID definition.
 type abeidHeader struct {
 	ABFlags [4]byte
-	GUID    [16]byte
+	GUID    GUID
 	Version uint32
 }
 
@@ -119,6 +115,17 @@ type abeidV1Data struct {
 // NewABEIDFromBytes takes a byte value and returns the ABEID represented by
 // those bytes.
 func NewABEIDFromBytes(value []byte) (ABEID, error) {
+	return newABEIDFromBytes(value, false)
+}
+
+// NewABEIDFromBytesStrict takes a byte value and returns the ABEID represented
+// by those bytes. Other than NewABEIDFromBytes, it rejects values with invalid
+// padding, non canonical base64 encoded exID values or trailing data.
+func NewABEIDFromBytesStrict(value []byte) (ABEID, error) {
+	return newABEIDFromBytes(value, true)
+}
+
+func newABEIDFromBytes(value []byte, strict bool) (ABEID, error) {
 	reader := bytes.NewReader(value)
 
 	// Parse header into header struct.
@@ -144,10 +151,25 @@ func NewABEIDFromBytes(value []byte) (ABEID, error) {
 			break
 		}
 		// Remove padding.
+		exIDPadded := exIDRaw
 		exIDRaw = unpadBytesRightWithRune(exIDRaw, '\x00')
+		encoding := base64.StdEncoding
+		if strict {
+			// Kopano pads the exID with at most four null bytes to a
+			// multiple of four bytes. Unpadded exIDs are accepted as well.
+			if padding := len(exIDPadded) - len(exIDRaw); padding > 4 || (padding > 0 && len(exIDPadded)%4 != 0) {
+				err = fmt.Errorf("ABEID invalid exID padding")
+				break
+			}
+			if bytes.ContainsAny(exIDRaw, "\r\n") {
+				err = fmt.Errorf("ABEID invalid exID data")
+				break
+			}
+			encoding = encoding.Strict()
+		}
 		// Decode.
-		exID := make([]byte, base64.StdEncoding.DecodedLen(len(exIDRaw)))
-		n, decodeErr := base64.StdEncoding.Decode(exID, exIDRaw)
+		exID := make([]byte, encoding.DecodedLen(len(exIDRaw)))
+		n, decodeErr := encoding.Decode(exID, exIDRaw)
 		if decodeErr != nil {
 			err = decodeErr
 			break
@@ -172,29 +194,57 @@ func NewABEIDFromBytes(value []byte) (ABEID, error) {
 // NewABEIDFromHex takes a hex encoded byte value and returns the ABEID
 // represented by those bytes.
 func NewABEIDFromHex(hexValue []byte) (ABEID, error) {
+	return newABEIDFromHex(hexValue, false)
+}
+
+// NewABEIDFromHexStrict is like NewABEIDFromHex but parses the decoded value
+// with NewABEIDFromBytesStrict.
+func NewABEIDFromHexStrict(hexValue []byte) (ABEID, error) {
+	return newABEIDFromHex(hexValue, true)
+}
+
+func newABEIDFromHex(hexValue []byte, strict bool) (ABEID, error) {
 	value := make([]byte, hex.DecodedLen(len(hexValue)))
 
 	if _, err := hex.Decode(value, hexValue); err != nil {
 		return nil, err
 	}
 
-	return NewABEIDFromBytes(value)
+	return newABEIDFromBytes(value, strict)
 }
 
 // NewABEIDFromBase64 takes a base64Std encoded byte value and returns the ABEID
 // represented by those bytes.
 func NewABEIDFromBase64(base64Value []byte) (ABEID, error) {
-	value := make([]byte, base64.StdEncoding.DecodedLen(len(base64Value)))
+	return newABEIDFromBase64(base64Value, false)
+}
 
-	if _, err := base64.StdEncoding.Decode(value, base64Value); err != nil {
+// NewABEIDFromBase64Strict is like NewABEIDFromBase64 but requires canonical
+// base64 and parses the decoded value with NewABEIDFromBytesStrict.
+func NewABEIDFromBase64Strict(base64Value []byte) (ABEID, error) {
+	return newABEIDFromBase64(base64Value, true)
+}
+
+func newABEIDFromBase64(base64Value []byte, strict bool) (ABEID, error) {
+	encoding := base64.StdEncoding
+	if strict {
+		if bytes.ContainsAny(base64Value, "\r\n") {
+			return nil, fmt.Errorf("ABEID invalid base64 data")
+		}
+		encoding = encoding.Strict()
+	}
+	value := make([]byte, encoding.DecodedLen(len(base64Value)))
+
+	n, err := encoding.Decode(value, base64Value)
+	if err != nil {
 		return nil, err
 	}
 
-	return NewABEIDFromBytes(value)
+	return newABEIDFromBytes(value[:n], strict)
 }
 
 // NewABEIDV1 creates a new NewABEIDV1 from the provided values.
-func NewABEIDV1(guid [16]byte, typE MAPIType, id uint32, exID []byte) (ABEID, error) {
+func NewABEIDV1(guid GUID, typE MAPIType, id uint32, exID []byte) (ABEID, error) {
 	abeid := &abeidV1{
 		header: &abeidHeader{
 			GUID:    guid,
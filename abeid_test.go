@@ -19,6 +19,7 @@ package kcc
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"testing"
 )
 
@@ -189,3 +190,76 @@ func TestNewABEIDV1(t *testing.T) {
 		t.Error("ABEID compare mismatch a and b", a.String(), b.String())
 	}
 }
+
+func TestABEIDFromHexStrict(t *testing.T) {
+	valid := [][]byte{
+		[]byte("00000000ac21a95040d3ee48b319fba7533044250100000006000000040000004d673d3d00000000"),
+		[]byte("00000000ac21a95040d3ee48b319fba7533044250100000006000000040000004d673d3d"), // No padding.
+	}
+	invalid := [][]byte{
+		[]byte("00000000ac21a95040d3ee48b319fba7533044250100000006000000040000004d673d3d0000000000"), // Too much padding.
+		[]byte("00000000ac21a95040d3ee48b319fba7533044250100000006000000040000004d673d3d000000"),     // Unaligned padding.
+		[]byte("00000000ac21a95040d3ee48b319fba7533044250100000006000000040000004d680d0a3d3d"),       // Line break in exID.
+		[]byte("00000000ac21a95040d3ee48b319fba7533044250100000006000000040000004d683d3d"),           // Non canonical exID.
+	}
+
+	for idx, value := range valid {
+		if _, err := NewABEIDFromHexStrict(value); err != nil {
+			t.Errorf("ABEID(%d) strict parse failed: %v", idx, err)
+		}
+	}
+	for idx, value := range invalid {
+		if _, err := NewABEIDFromHex(value); err != nil {
+			t.Errorf("ABEID(%d) parse failed: %v", idx, err)
+		}
+		if _, err := NewABEIDFromHexStrict(value); err == nil {
+			t.Errorf("ABEID(%d) strict parse succeeded while it should fail", idx)
+		}
+	}
+}
+
+func TestABEIDValueEncoding(t *testing.T) {
+	value := "AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAMAAABNZz09"
+
+	var v ABEIDValue
+	if err := json.Unmarshal([]byte(`"`+value+`"`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.ABEID == nil || v.ID() != 3 {
+		t.Fatalf("ABEIDValue unexpected value after JSON unmarshal: %v", v.ABEID)
+	}
+	data, err := json.Marshal(v.ABEID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"`+value+`"` {
+		t.Errorf("ABEID JSON value mismatch got %s, wanted %v", data, value)
+	}
+
+	if err = v.Scan(nil); err != nil || v.ABEID != nil {
+		t.Errorf("ABEIDValue scan of nil failed: %v", err)
+	}
+	if dv, _ := v.Value(); dv != nil {
+		t.Errorf("ABEIDValue null value mismatch got %v", dv)
+	}
+	if err = v.Scan([]byte(value + "\n")); err == nil {
+		t.Error("ABEIDValue scan of value with trailing data succeeded while it should fail")
+	}
+	if err = v.Scan(value); err != nil {
+		t.Fatal(err)
+	}
+	if dv, _ := v.Value(); dv != value {
+		t.Errorf("ABEIDValue SQL value mismatch got %v, wanted %v", dv, value)
+	}
+
+	h := ABEIDValue{Encoding: ABEIDEncodingHex}
+	if err = h.Scan(value); err == nil {
+		t.Error("ABEIDValue hex scan of base64 value succeeded while it should fail")
+	}
+	if err = h.Scan(v.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if text, _ := h.MarshalText(); string(text) != v.Hex() {
+		t.Errorf("ABEIDValue hex text value mismatch got %s, wanted %v", text, v.Hex())
+	}
+}
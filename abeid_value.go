@@ -0,0 +1,146 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// ABEIDEncoding is the type selecting the canonical text form of ABEIDs.
+type ABEIDEncoding int
+
+// Supported ABEID text encodings. ABEIDEncodingBase64 is the default.
+const (
+	ABEIDEncodingBase64 ABEIDEncoding = iota
+	ABEIDEncodingHex
+)
+
+func (enc ABEIDEncoding) encode(abeid ABEID) string {
+	switch enc {
+	case ABEIDEncodingHex:
+		return abeid.Hex()
+	default:
+		return abeid.String()
+	}
+}
+
+func (enc ABEIDEncoding) decode(text []byte) (ABEID, error) {
+	switch enc {
+	case ABEIDEncodingHex:
+		return NewABEIDFromHexStrict(text)
+	default:
+		return NewABEIDFromBase64Strict(text)
+	}
+}
+
+// MarshalText implements the encoding.TextMarshaler interface using the
+// base64 text form.
+func (abeid *abeidV1) MarshalText() ([]byte, error) {
+	return []byte(abeid.String()), nil
+}
+
+// MarshalJSON implements the json.Marshaler interface using the base64 text
+// form.
+func (abeid *abeidV1) MarshalJSON() ([]byte, error) {
+	return json.Marshal(abeid.String())
+}
+
+// Value implements the driver.Valuer interface using the base64 text form.
+func (abeid *abeidV1) Value() (driver.Value, error) {
+	return abeid.String(), nil
+}
+
+// An ABEIDValue holds an ABEID and can be used as destination when decoding
+// text, JSON and SQL values. Values are parsed strictly in the canonical form
+// as selected by Encoding. A nil ABEID represents null.
+type ABEIDValue struct {
+	ABEID
+
+	// Encoding selects the canonical text form of the associated ABEID.
+	Encoding ABEIDEncoding
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (v ABEIDValue) MarshalText() ([]byte, error) {
+	if v.ABEID == nil {
+		return []byte{}, nil
+	}
+	return []byte(v.Encoding.encode(v.ABEID)), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (v *ABEIDValue) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		v.ABEID = nil
+		return nil
+	}
+
+	abeid, err := v.Encoding.decode(text)
+	if err != nil {
+		return err
+	}
+	v.ABEID = abeid
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (v ABEIDValue) MarshalJSON() ([]byte, error) {
+	if v.ABEID == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(v.Encoding.encode(v.ABEID))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (v *ABEIDValue) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		v.ABEID = nil
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	return v.UnmarshalText([]byte(text))
+}
+
+// Scan implements the sql.Scanner interface. Supported source values are nil,
+// string and []byte, holding the canonical text form.
+func (v *ABEIDValue) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		v.ABEID = nil
+		return nil
+	case string:
+		return v.UnmarshalText([]byte(value))
+	case []byte:
+		return v.UnmarshalText(value)
+	default:
+		return fmt.Errorf("ABEID unsupported scan type %T", src)
+	}
+}
+
+// Value implements the driver.Valuer interface.
+func (v ABEIDValue) Value() (driver.Value, error) {
+	if v.ABEID == nil {
+		return nil, nil
+	}
+	return v.Encoding.encode(v.ABEID), nil
+}
@@ -0,0 +1,265 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultCircuitBreakerFailureThreshold is the default number of
+	// consecutive failed requests after which a circuit breaker opens.
+	DefaultCircuitBreakerFailureThreshold = 5
+	// DefaultCircuitBreakerOpenTimeout is the default duration a circuit
+	// breaker stays open before it lets a trial request through.
+	DefaultCircuitBreakerOpenTimeout = 30 * time.Second
+)
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+// Circuit breaker states.
+const (
+	// CircuitClosed lets all requests through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all requests.
+	CircuitOpen
+	// CircuitHalfOpen lets a single trial request through.
+	CircuitHalfOpen
+)
+
+func (state CircuitState) String() string {
+	switch state {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// A CircuitOpenError is the error returned by a CircuitBreakerSOAPClient for
+// requests which are rejected without being sent to the server.
+type CircuitOpenError struct {
+	State CircuitState
+	// RetryAfter is the duration after which the circuit breaker lets a trial
+	// request through, zero while a trial request is in flight.
+	RetryAfter time.Duration
+}
+
+func (err *CircuitOpenError) Error() string {
+	return fmt.Sprintf("soap circuit breaker is %s", err.State)
+}
+
+// IsCircuitOpen returns true if the provided error or any error it wraps is a
+// CircuitOpenError.
+func IsCircuitOpen(err error) bool {
+	var circuitErr *CircuitOpenError
+	return errors.As(err, &circuitErr)
+}
+
+// A CircuitBreakerSOAPClient wraps a SOAPClient and fails fast with a
+// CircuitOpenError once a number of consecutive requests failed with a
+// transport error or timeout. After OpenTimeout, a single trial request is
+// let through, which closes the circuit again when successful.
+//
+// Requests canceled by their context do not count as failure, neither do
+// responses of the server except temporary HTTP errors like 503. Requests
+// which exceeded the deadline of their context count as timeout.
+type CircuitBreakerSOAPClient struct {
+	Client SOAPClient
+
+	FailureThreshold int
+	OpenTimeout      time.Duration
+
+	// OnStateChange is called with the previous and the new state whenever
+	// the state changes if set.
+	OnStateChange func(from, to CircuitState)
+
+	mutex    sync.Mutex
+	state    CircuitState
+	failures int
+	opened   time.Time
+	trial    bool
+}
+
+// NewCircuitBreakerSOAPClient creates a new CircuitBreakerSOAPClient wrapping
+// the provided client. Zero values for failureThreshold and openTimeout select
+// DefaultCircuitBreakerFailureThreshold and DefaultCircuitBreakerOpenTimeout.
+func NewCircuitBreakerSOAPClient(client SOAPClient, failureThreshold int, openTimeout time.Duration) *CircuitBreakerSOAPClient {
+	if failureThreshold <= 0 {
+		failureThreshold = DefaultCircuitBreakerFailureThreshold
+	}
+	if openTimeout <= 0 {
+		openTimeout = DefaultCircuitBreakerOpenTimeout
+	}
+
+	return &CircuitBreakerSOAPClient{
+		Client: client,
+
+		FailureThreshold: failureThreshold,
+		OpenTimeout:      openTimeout,
+	}
+}
+
+// DoRequest sends the provided payload data as SOAP through the means of the
+// accociated client unless the circuit is open.
+func (cb *CircuitBreakerSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	if err := cb.allow(); err != nil {
+		return err
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	err := cb.Client.DoRequest(ctx, payload, v)
+	cb.record(ctx, err)
+
+	return err
+}
+
+// DoStreamRequest sends the payload read from the provided reader as SOAP
+// through the means of the accociated client unless the circuit is open, and
+// calls the provided decoder with the response.
+func (cb *CircuitBreakerSOAPClient) DoStreamRequest(ctx context.Context, method string, payload io.Reader, decode SOAPResponseDecoder) error {
+	if err := cb.allow(); err != nil {
+		return err
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	err := NewSOAPStreamClient(cb.Client).DoStreamRequest(ctx, method, payload, decode)
+	cb.record(ctx, err)
+
+	return err
+}
+
+// State returns the current state of the accociated client.
+func (cb *CircuitBreakerSOAPClient) State() CircuitState {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.state
+}
+
+// SetLogger sets the Logger of the accociated client, if supported.
+func (cb *CircuitBreakerSOAPClient) SetLogger(logger Logger) {
+	if setter, ok := cb.Client.(loggerSetter); ok {
+		setter.SetLogger(logger)
+	}
+}
+
+func (cb *CircuitBreakerSOAPClient) String() string {
+	return fmt.Sprintf("<breaker:%s>", cb.Client)
+}
+
+// allow returns a CircuitOpenError if a request must not be sent.
+func (cb *CircuitBreakerSOAPClient) allow() error {
+	cb.mutex.Lock()
+	from := cb.state
+
+	switch cb.state {
+	case CircuitOpen:
+		if wait := cb.OpenTimeout - time.Since(cb.opened); wait > 0 {
+			cb.mutex.Unlock()
+			return &CircuitOpenError{
+				State:      CircuitOpen,
+				RetryAfter: wait,
+			}
+		}
+		cb.state = CircuitHalfOpen
+		cb.trial = true
+
+	case CircuitHalfOpen:
+		if cb.trial {
+			cb.mutex.Unlock()
+			return &CircuitOpenError{
+				State: CircuitHalfOpen,
+			}
+		}
+		cb.trial = true
+	}
+
+	to := cb.state
+	cb.mutex.Unlock()
+
+	cb.notify(from, to)
+	return nil
+}
+
+// record updates the state according to the result of a request sent with
+// the provided context.
+func (cb *CircuitBreakerSOAPClient) record(ctx context.Context, err error) {
+	cb.mutex.Lock()
+	from := cb.state
+
+	switch {
+	case err != nil && ctx.Err() == context.Canceled:
+		// Canceled by the caller, neither success nor failure.
+	case isCircuitFailure(err):
+		cb.failures++
+		if cb.state == CircuitHalfOpen || (cb.state == CircuitClosed && cb.failures >= cb.FailureThreshold) {
+			cb.state = CircuitOpen
+			cb.opened = time.Now()
+		}
+	default:
+		cb.failures = 0
+		cb.state = CircuitClosed
+	}
+	if from == CircuitHalfOpen {
+		cb.trial = false
+	}
+
+	to := cb.state
+	cb.mutex.Unlock()
+
+	cb.notify(from, to)
+}
+
+func (cb *CircuitBreakerSOAPClient) notify(from, to CircuitState) {
+	if from != to && cb.OnStateChange != nil {
+		cb.OnStateChange(from, to)
+	}
+}
+
+// isCircuitFailure returns true for errors which signal that the server could
+// not be reached or did not respond in time.
+func isCircuitFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return isRetryableTransportError(err)
+}
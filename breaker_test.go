@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerSOAPClient(t *testing.T) {
+	failing := true
+	requests := 0
+	client := NewCircuitBreakerSOAPClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		requests++
+		if failing {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}), 2, 20*time.Millisecond)
+	var changes []CircuitState
+	client.OnStateChange = func(from, to CircuitState) {
+		changes = append(changes, to)
+	}
+
+	payload := "<ns:getUser></ns:getUser>"
+	for idx := 0; idx < 2; idx++ {
+		if err := client.DoRequest(context.Background(), &payload, &GetUserResponse{}); err != io.ErrUnexpectedEOF {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if client.State() != CircuitOpen {
+		t.Fatalf("circuit did not open after failures: %v", client.State())
+	}
+
+	err := client.DoRequest(context.Background(), &payload, &GetUserResponse{})
+	if !IsCircuitOpen(err) || requests != 2 {
+		t.Errorf("request was not rejected while open: %v", err)
+	}
+	if circuitErr, ok := err.(*CircuitOpenError); !ok || circuitErr.RetryAfter <= 0 {
+		t.Errorf("unexpected circuit open error: %#v", err)
+	}
+
+	// Failed trial request opens the circuit again.
+	time.Sleep(25 * time.Millisecond)
+	if err = client.DoRequest(context.Background(), &payload, &GetUserResponse{}); err != io.ErrUnexpectedEOF {
+		t.Errorf("trial request was not sent: %v", err)
+	}
+	if client.State() != CircuitOpen {
+		t.Errorf("circuit did not open again after failed trial: %v", client.State())
+	}
+
+	// Successful trial request closes the circuit.
+	failing = false
+	time.Sleep(25 * time.Millisecond)
+	if err = client.DoRequest(context.Background(), &payload, &GetUserResponse{}); err != nil {
+		t.Errorf("trial request failed: %v", err)
+	}
+	if client.State() != CircuitClosed {
+		t.Errorf("circuit did not close after successful trial: %v", client.State())
+	}
+
+	expected := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected state changes: %v", changes)
+	}
+}
+
+func TestCircuitBreakerSOAPClientIgnoresCanceled(t *testing.T) {
+	client := NewCircuitBreakerSOAPClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), 1, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	payload := "<ns:getUser></ns:getUser>"
+	client.DoRequest(ctx, &payload, &GetUserResponse{})
+	if client.State() != CircuitClosed {
+		t.Errorf("circuit opened for canceled request")
+	}
+}
+
+func TestCircuitBreakerSOAPClientDeadline(t *testing.T) {
+	client := NewCircuitBreakerSOAPClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), 1, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	payload := "<ns:getUser></ns:getUser>"
+	if err := client.DoRequest(ctx, &payload, &GetUserResponse{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error, got %v", err)
+	}
+	if client.State() != CircuitOpen {
+		t.Errorf("circuit was not opened for request which exceeded its deadline")
+	}
+}
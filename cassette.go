@@ -0,0 +1,245 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrCassetteNoMatch is the error returned by a ReplayingSOAPClient for
+// requests which match no recorded request.
+var ErrCassetteNoMatch = errors.New("no matching request in cassette")
+
+// A CassetteEntry is a recorded SOAP request with its raw response, as
+// stored in a JSONL cassette.
+type CassetteEntry struct {
+	Method     string `json:"method"`
+	Payload    string `json:"payload"`
+	StatusCode int    `json:"status"`
+	Response   string `json:"response"`
+}
+
+// A RecordingSOAPClient wraps a SOAPClient and writes every request with its
+// raw response as CassetteEntry line of JSON to a writer. Requests which
+// failed without response are not recorded. Raw responses are only available
+// from SOAPHTTPClient and SOAPSocketClient based clients. To record streamed
+// requests, NewSOAPStreamClient reads their payload into memory.
+type RecordingSOAPClient struct {
+	Client SOAPClient
+
+	// Redact is applied to request payloads before recording if set. It
+	// must be the same function used as Normalize of the replaying client.
+	Redact func(string) string
+	// RedactResponse is applied to raw responses before recording if set.
+	RedactResponse func(string) string
+
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewRecordingSOAPClient creates a new RecordingSOAPClient wrapping the
+// provided client, which writes cassette entries to the provided writer.
+// Passwords, SSO tokens and session IDs of requests are redacted with
+// RedactSOAP.
+func NewRecordingSOAPClient(client SOAPClient, w io.Writer) *RecordingSOAPClient {
+	return &RecordingSOAPClient{
+		Client: client,
+
+		Redact: RedactSOAP,
+
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// DoRequest sends the provided payload data as SOAP through the means of the
+// accociated client and records the request and its response.
+func (rc *RecordingSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	capture := &responseCapture{}
+	err := rc.Client.DoRequest(context.WithValue(ctx, responseCaptureContextKey{}, capture), payload, v)
+	if capture.statusCode == 0 {
+		return err
+	}
+
+	entry := &CassetteEntry{
+		Method:     soapMethodName(payload),
+		Payload:    normalizeCassettePayload(payload, rc.Redact),
+		StatusCode: capture.statusCode,
+		Response:   string(capture.body),
+	}
+	if rc.RedactResponse != nil {
+		entry.Response = rc.RedactResponse(entry.Response)
+	}
+
+	rc.mutex.Lock()
+	encodeErr := rc.encoder.Encode(entry)
+	rc.mutex.Unlock()
+	if err == nil && encodeErr != nil {
+		err = fmt.Errorf("failed to record SOAP request: %w", encodeErr)
+	}
+
+	return err
+}
+
+// SetLogger sets the Logger of the accociated client, if supported.
+func (rc *RecordingSOAPClient) SetLogger(logger Logger) {
+	if setter, ok := rc.Client.(loggerSetter); ok {
+		setter.SetLogger(logger)
+	}
+}
+
+func (rc *RecordingSOAPClient) String() string {
+	return fmt.Sprintf("<record:%s>", rc.Client)
+}
+
+// A ReplayingSOAPClient implements a SOAP client which answers requests with
+// the responses of a cassette written by a RecordingSOAPClient. Requests are
+// matched by method and normalized payload. Multiple entries for the same
+// request are replayed in order, repeating the last one. To match streamed
+// requests, NewSOAPStreamClient reads their payload into memory.
+type ReplayingSOAPClient struct {
+	// Normalize is applied to request payloads before matching if set.
+	Normalize func(string) string
+
+	MaxResponseSize  int64
+	MaxResponseDepth int
+
+	mutex   sync.Mutex
+	entries map[string][]*CassetteEntry
+}
+
+// NewReplayingSOAPClient creates a new ReplayingSOAPClient with the cassette
+// entries read from the provided reader. Request payloads are normalized with
+// RedactSOAP, matching the defaults of NewRecordingSOAPClient.
+func NewReplayingSOAPClient(r io.Reader) (*ReplayingSOAPClient, error) {
+	rc := &ReplayingSOAPClient{
+		Normalize: RedactSOAP,
+
+		entries: make(map[string][]*CassetteEntry),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		entry := &CassetteEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette line %d: %w", line, err)
+		}
+		key := cassetteKey(entry.Method, entry.Payload)
+		rc.entries[key] = append(rc.entries[key], entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	return rc, nil
+}
+
+// DoRequest decodes the recorded response matching the provided payload data
+// into v.
+func (rc *ReplayingSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	method := soapMethodName(payload)
+	key := cassetteKey(method, normalizeCassettePayload(payload, rc.Normalize))
+
+	rc.mutex.Lock()
+	entries := rc.entries[key]
+	var entry *CassetteEntry
+	if len(entries) > 0 {
+		entry = entries[0]
+		if len(entries) > 1 {
+			rc.entries[key] = entries[1:]
+		}
+	}
+	rc.mutex.Unlock()
+
+	if entry == nil {
+		return fmt.Errorf("%w: %s", ErrCassetteNoMatch, method)
+	}
+
+	limits := newResponseLimits(rc.MaxResponseSize, rc.MaxResponseDepth)
+	data := limits.reader(strings.NewReader(entry.Response))
+	if entry.StatusCode != http.StatusOK {
+		return parseSOAPErrorResponse(entry.StatusCode, data, limits)
+	}
+	return parseSOAPResponse(entry.StatusCode, data, v, limits)
+}
+
+func (rc *ReplayingSOAPClient) String() string {
+	return "<replay>"
+}
+
+// normalizeCassettePayload returns the provided payload with surrounding
+// white space removed, passed through the provided normalize function if set.
+func normalizeCassettePayload(payload *string, normalize func(string) string) string {
+	if payload == nil {
+		return ""
+	}
+	normalized := strings.TrimSpace(*payload)
+	if normalize != nil {
+		normalized = normalize(normalized)
+	}
+	return normalized
+}
+
+func cassetteKey(method, payload string) string {
+	return method + "\x00" + payload
+}
+
+type responseCaptureContextKey struct{}
+
+// A responseCapture holds the raw SOAP response of a request.
+type responseCapture struct {
+	statusCode int
+	body       []byte
+}
+
+// captureResponse reads the provided response data into the responseCapture
+// of the provided context, if any. It returns a reader for the same data.
+func captureResponse(ctx context.Context, code int, data io.Reader) (io.Reader, error) {
+	if ctx == nil {
+		return data, nil
+	}
+	capture, ok := ctx.Value(responseCaptureContextKey{}).(*responseCapture)
+	if !ok {
+		return data, nil
+	}
+
+	raw, err := ioutil.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	capture.statusCode = code
+	capture.body = raw
+
+	return bytes.NewReader(raw), nil
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplaySOAPClient(t *testing.T) {
+	userID := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		switch {
+		case bytes.Contains(body, []byte("<ns:logon>")):
+			fmt.Fprint(rw, testSOAPResponse(`<ns:logonResponse><er>0</er><ulSessionId>1234</ulSessionId><sServerGuid>guid</sServerGuid></ns:logonResponse>`))
+		case bytes.Contains(body, []byte("<ns:resolveUsername>")):
+			userID++
+			fmt.Fprint(rw, testSOAPResponse(fmt.Sprintf(`<ns:resolveUsernameResponse><er>0</er><ulUserId>%d</ulUserId></ns:resolveUsernameResponse>`, userID)))
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(rw, testSOAPResponse(`<SOAP-ENV:Fault><faultcode>SOAP-ENV:Client</faultcode><faultstring>unknown method</faultstring></SOAP-ENV:Fault>`))
+		}
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	httpClient, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cassette bytes.Buffer
+	recorder := NewKCCWithClient(NewRecordingSOAPClient(httpClient, &cassette))
+	logon, err := recorder.Logon(context.Background(), "user1", "secret-password", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx := 0; idx < 2; idx++ {
+		if _, err = recorder.ResolveUsername(context.Background(), "user2", logon.SessionID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = recorder.Logoff(context.Background(), logon.SessionID); err == nil {
+		t.Fatal("expected SOAP fault for logoff")
+	}
+
+	if strings.Contains(cassette.String(), "secret-password") {
+		t.Errorf("password was recorded: %s", cassette.String())
+	}
+	if lines := strings.Count(cassette.String(), "\n"); lines != 4 {
+		t.Errorf("unexpected number of recorded entries: %d", lines)
+	}
+
+	client, err := NewReplayingSOAPClient(&cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer := NewKCCWithClient(client)
+
+	// Session IDs are redacted, so replay matches any session.
+	logon, err = replayer.Logon(context.Background(), "user1", "other-password", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logon.SessionID != 1234 || logon.ServerGUID != "guid" {
+		t.Errorf("unexpected replayed logon response: %+v", logon)
+	}
+	for idx, expected := range []uint64{1, 2, 2} {
+		resp, resolveErr := replayer.ResolveUsername(context.Background(), "user2", 5678)
+		if resolveErr != nil {
+			t.Fatal(resolveErr)
+		}
+		if resp.ID != expected {
+			t.Errorf("unexpected replayed response %d: %+v", idx, resp)
+		}
+	}
+
+	var fault *SOAPFault
+	if _, err = replayer.Logoff(context.Background(), 5678); !errors.As(err, &fault) || !fault.IsClientFault() {
+		t.Errorf("expected replayed SOAP fault, got %v", err)
+	}
+
+	if _, err = replayer.ResolveUsername(context.Background(), "user3", 5678); !errors.Is(err, ErrCassetteNoMatch) {
+		t.Errorf("expected no match error, got %v", err)
+	}
+}
@@ -195,13 +195,11 @@ func (s *Server) userinfoHandler(rw http.ResponseWriter, req *http.Request) {
 		}
 
 		if failedErr != nil {
-			switch failedErr {
-			case kcc.KCERR_END_OF_SESSION:
-				session.Destroy(req.Context(), false)
-			default:
+			if !kcc.IsSessionEnded(failedErr) {
 				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				return
 			}
+			session.Destroy(req.Context(), false)
 		}
 
 		// If reach here, its a retry.
@@ -329,13 +327,11 @@ func (s *Server) abResolveNamesHandler(rw http.ResponseWriter, req *http.Request
 		}
 
 		if failedErr != nil {
-			switch failedErr {
-			case kcc.KCERR_END_OF_SESSION:
-				session.Destroy(req.Context(), false)
-			default:
+			if !kcc.IsSessionEnded(failedErr) {
 				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				return
 			}
+			session.Destroy(req.Context(), false)
 		}
 
 		// If reach here, its a retry.
@@ -20,7 +20,6 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
-	"net/http"
 	"net/url"
 	"os"
 
@@ -55,6 +54,9 @@ func commandServe() *cobra.Command {
 	serveCmd.Flags().String("server-uri", "", "Kopano server URI")
 	serveCmd.Flags().String("server-auth-pem", "", "Full path to a PEM encoded x509 certificate with private key file")
 	serveCmd.Flags().Bool("insecure", false, "Disable TLS certificate and hostname validation")
+	serveCmd.Flags().String("server-proxy", "", "HTTP or SOCKS5 proxy URI used to connect to the Kopano server")
+	serveCmd.Flags().String("server-ca-pem", "", "Full path to a PEM encoded CA bundle trusted for the Kopano server")
+	serveCmd.Flags().StringSlice("server-pin-sha256", nil, "Base64 encoded SHA-256 hash of a trusted public key of the Kopano server")
 
 	return serveCmd
 }
@@ -71,6 +73,7 @@ func serve(cmd *cobra.Command, args []string) error {
 
 	var serverURI *url.URL
 	var tlsConfig *tls.Config
+	var opts []kcc.Option
 
 	listenAddr, _ := cmd.Flags().GetString("listen")
 	if serverURIString, err := cmd.Flags().GetString("server-uri"); err == nil && serverURIString != "" {
@@ -104,12 +107,12 @@ func serve(cmd *cobra.Command, args []string) error {
 			logger.Debugln("http2 client support is disabled (insecure mode)")
 		}
 
-		kcc.DefaultHTTPClient.Transport.(*http.Transport).TLSClientConfig = tlsConfig
+		opts = append(opts, kcc.WithTLSClientConfig(tlsConfig))
 		fallthrough
-	case "http":
-	case "file":
 	default:
-		return fmt.Errorf("unsupported server-uri scheme: %v", serverURI.Scheme)
+		if _, ok := kcc.LookupSOAPScheme(serverURI.Scheme); !ok {
+			return fmt.Errorf("unsupported server-uri scheme: %v", serverURI.Scheme)
+		}
 	}
 
 	if serverAuthPEM, err := cmd.Flags().GetString("server-auth-pem"); err == nil && serverAuthPEM != "" {
@@ -124,7 +127,41 @@ func serve(cmd *cobra.Command, args []string) error {
 		logger.Infoln("using TLS client certificate for server auth")
 	}
 
-	srv := NewServer(listenAddr, serverURI, logger)
+	if serverCAPEM, err := cmd.Flags().GetString("server-ca-pem"); err == nil && serverCAPEM != "" {
+		if tlsConfig == nil {
+			return fmt.Errorf("this server-uri cannot be used together with server-ca-pem, a https:// uri is required")
+		}
+
+		pool, err := kcc.LoadCertPool(serverCAPEM)
+		if err != nil {
+			return fmt.Errorf("failed to load server-ca-pem file: %v", err)
+		}
+		opts = append(opts, kcc.WithRootCAs(pool))
+		logger.Infoln("using custom CA bundle for server")
+	}
+
+	if pins, err := cmd.Flags().GetStringSlice("server-pin-sha256"); err == nil && len(pins) > 0 {
+		if tlsConfig == nil {
+			return fmt.Errorf("this server-uri cannot be used together with server-pin-sha256, a https:// uri is required")
+		}
+
+		opts = append(opts, kcc.WithPinnedSPKI(pins...))
+		logger.Infof("pinning server public key to %d hashes", len(pins))
+	}
+
+	if serverProxy, err := cmd.Flags().GetString("server-proxy"); err == nil && serverProxy != "" {
+		proxyURI, err := url.Parse(serverProxy)
+		if err != nil {
+			return fmt.Errorf("failed to parse server-proxy: %v", err)
+		}
+		opts = append(opts, kcc.WithHTTPProxy(proxyURI))
+		logger.WithField("proxy", proxyURI.Host).Infoln("using proxy for server connections")
+	}
+
+	srv, err := NewServer(listenAddr, serverURI, logger, opts...)
+	if err != nil {
+		return err
+	}
 
 	logger.Infof("serve started")
 	return srv.Serve(ctx, username, password)
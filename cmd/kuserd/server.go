@@ -46,18 +46,29 @@ type Server struct {
 	withRequestMetrics bool
 }
 
-// NewServer creates a new Server with the provided parameters.
-func NewServer(listenAddr string, serverURI *url.URL, logger logrus.FieldLogger) *Server {
+// NewServer creates a new Server with the provided parameters. The provided
+// options are used for the connection to the Kopano server in addition to the
+// environment.
+func NewServer(listenAddr string, serverURI *url.URL, logger logrus.FieldLogger, opts ...kcc.Option) (*Server, error) {
+	opts = append([]kcc.Option{
+		kcc.WithEnvironment(),
+		kcc.WithClientApp("kcc-go-kuserd", kcc.Version),
+	}, opts...)
+	c, err := kcc.New(serverURI, opts...)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &Server{
-		c:          kcc.NewKCC(serverURI),
+		c:          c,
 		listenAddr: listenAddr,
 		logger:     logger,
 	}
-	s.c.SetClientApp("kcc-go-kuserd", kcc.Version)
+	s.c.Client = kcc.NewRetryingSOAPClient(s.c.Client, nil)
 
 	logger.WithField("client", s.c.String()).Infoln("backend server connection set up")
 
-	return s
+	return s, nil
 }
 
 func (s *Server) addContext(parent context.Context, next http.Handler) http.Handler {
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// A SOAPCompression configures gzip compression of SOAP requests and
+// responses.
+type SOAPCompression struct {
+	// RequestThreshold is the minimum envelope size in bytes for requests to
+	// be sent gzip compressed. Set to a negative value to never compress
+	// requests.
+	RequestThreshold int
+	// Level is the gzip compression level, see compress/gzip.
+	Level int
+	// AcceptGzip enables negotiation of gzip compressed responses.
+	AcceptGzip bool
+}
+
+// DefaultSOAPCompression is a SOAPCompression suitable for most clients. It
+// compresses requests of at least 1 KiB and accepts compressed responses.
+var DefaultSOAPCompression = &SOAPCompression{
+	RequestThreshold: 1024,
+	Level:            gzip.DefaultCompression,
+	AcceptGzip:       true,
+}
+
+// compressRequest returns true if an envelope of the provided size is sent
+// gzip compressed according to the accociated SOAPCompression.
+func (sc *SOAPCompression) compressRequest(size int) bool {
+	return sc != nil && sc.RequestThreshold >= 0 && size >= sc.RequestThreshold
+}
+
+// gzipWriterPools hold reusable gzip writers for all compression levels from
+// gzip.HuffmanOnly to gzip.BestCompression.
+var gzipWriterPools [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+
+// encodeRequest returns the gzip compressed envelope read from the provided
+// reader.
+func (sc *SOAPCompression) encodeRequest(body io.Reader) (*bytes.Buffer, error) {
+	var compressed bytes.Buffer
+	if err := sc.writeRequest(&compressed, body); err != nil {
+		return nil, err
+	}
+	return &compressed, nil
+}
+
+// writeRequest writes the envelope read from the provided reader gzip
+// compressed to the provided writer.
+func (sc *SOAPCompression) writeRequest(w io.Writer, body io.Reader) error {
+	var pool *sync.Pool
+	var gw *gzip.Writer
+	if sc.Level >= gzip.HuffmanOnly && sc.Level <= gzip.BestCompression {
+		pool = &gzipWriterPools[sc.Level-gzip.HuffmanOnly]
+		gw, _ = pool.Get().(*gzip.Writer)
+	}
+	if gw != nil {
+		gw.Reset(w)
+	} else {
+		var err error
+		gw, err = gzip.NewWriterLevel(w, sc.Level)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.Copy(gw, body); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	if pool != nil {
+		pool.Put(gw)
+	}
+
+	return nil
+}
+
+// setRequestHeaders sets the HTTP headers for the provided request according
+// to the accociated SOAPCompression.
+func (sc *SOAPCompression) setRequestHeaders(header http.Header, compressed bool) {
+	if sc == nil {
+		return
+	}
+	if compressed {
+		header.Set("Content-Encoding", "gzip")
+	}
+	if sc.AcceptGzip {
+		header.Set("Accept-Encoding", "gzip")
+	}
+}
+
+// decodeResponseBody returns a reader for the decoded body of the provided
+// response, decompressing gzip encoded bodies.
+func decodeResponseBody(resp *http.Response, body io.Reader) (io.Reader, error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode gzip response: %w", err)
+		}
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unsupported response content encoding: %v", encoding)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testCompressionHandler struct {
+	requestEncoding string
+	requestBody     string
+}
+
+func (h *testCompressionHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	var body io.Reader = req.Body
+	h.requestEncoding = req.Header.Get("Content-Encoding")
+	if h.requestEncoding == "gzip" {
+		gr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = gr
+	}
+	raw, _ := ioutil.ReadAll(body)
+	h.requestBody = string(raw)
+
+	response := testSOAPResponse("<ns:resolveUsernameResponse><er>0</er><ulUserId>42</ulUserId></ns:resolveUsernameResponse>")
+	if req.Header.Get("Accept-Encoding") == "gzip" {
+		rw.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(rw)
+		io.WriteString(gw, response)
+		gw.Close()
+		return
+	}
+	io.WriteString(rw, response)
+}
+
+func testCompressedRequest(t *testing.T, client SOAPClient, h *testCompressionHandler, username string, expectedEncoding string) {
+	response, err := NewKCCWithClient(client).ResolveUsername(context.Background(), username, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.ID != 42 {
+		t.Errorf("unexpected response: %+v", response)
+	}
+	if h.requestEncoding != expectedEncoding {
+		t.Errorf("unexpected request encoding: %q, expected %q", h.requestEncoding, expectedEncoding)
+	}
+	if !strings.Contains(h.requestBody, username) {
+		t.Errorf("unexpected request body: %s", h.requestBody)
+	}
+}
+
+func TestSOAPHTTPClientCompression(t *testing.T) {
+	h := &testCompressionHandler{}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Compression = DefaultSOAPCompression
+
+	testCompressedRequest(t, client, h, "user1", "")
+	testCompressedRequest(t, client, h, strings.Repeat("user", 512), "gzip")
+}
+
+func TestSOAPSocketClientCompression(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kcc-go-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "server.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &testCompressionHandler{}
+	srv := &http.Server{Handler: h}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	client, err := NewSOAPSocketClient(&url.URL{Scheme: "file", Path: path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Compression = &SOAPCompression{
+		RequestThreshold: 0,
+		Level:            gzip.BestSpeed,
+		AcceptGzip:       true,
+	}
+
+	testCompressedRequest(t, client, h, "user1", "gzip")
+}
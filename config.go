@@ -0,0 +1,477 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// A Config is a collection of settings used when constructing a KCC with New.
+// Unlike the package level defaults, each Config is independent, so multiple
+// clients with different settings can be used in the same process.
+type Config struct {
+	// URI is the Kopano server URI used when New is called without URI.
+	URI string
+
+	AppName       string
+	AppVersion    string
+	ClientVersion int
+	Capabilities  KCFlag
+
+	// HTTPClient is used for HTTP SOAP requests if set. Otherwise a new
+	// http.Client is created from the HTTP settings below.
+	HTTPClient              *http.Client
+	HTTPTimeout             time.Duration
+	HTTPDialTimeout         time.Duration
+	HTTPKeepAlive           time.Duration
+	HTTPIdleConnTimeout     time.Duration
+	HTTPMaxIdleConns        int
+	HTTPMaxIdleConnsPerHost int
+	HTTPDualStack           bool
+
+	// HTTPProxy, TLSClientConfig, RootCAs and PinnedSPKI configure the
+	// proxy and TLS settings for HTTP SOAP requests, see SOAPClientConfig.
+	// They are also applied to a copy of HTTPClient if set.
+	HTTPProxy       *url.URL
+	TLSClientConfig *tls.Config
+	RootCAs         *x509.CertPool
+	PinnedSPKI      []string
+
+	UnixDialTimeout     time.Duration
+	UnixMaxConnections  int
+	UnixIdleConnTimeout time.Duration
+
+	// MaxResponseSize and MaxResponseDepth limit the responses of the SOAP
+	// client. Zero means the package defaults, negative means unlimited.
+	MaxResponseSize  int64
+	MaxResponseDepth int
+
+	// Compression enables gzip compression for the SOAP client if set.
+	Compression *SOAPCompression
+
+	// MaxInFlight limits the number of parallel SOAP requests if greater
+	// than zero, with up to MaxQueue requests waiting, see
+	// LimitingSOAPClient.
+	MaxInFlight int
+	MaxQueue    int
+
+	// CircuitBreakerThreshold enables a circuit breaker which opens after
+	// the given number of consecutive failures if greater than zero, see
+	// CircuitBreakerSOAPClient.
+	CircuitBreakerThreshold   int
+	CircuitBreakerOpenTimeout time.Duration
+
+	SessionAutorefreshInterval time.Duration
+
+	// Logger is set on the SOAP client if not nil.
+	Logger Logger
+}
+
+// An Option sets a setting of a Config.
+type Option func(*Config)
+
+// NewConfig creates a Config with the current package defaults, such as
+// DefaultURI, DefaultAppName and ClientVersion, and applies the provided
+// options. Environment variables are not used unless the WithEnvironment
+// option is provided.
+func NewConfig(opts ...Option) *Config {
+	cfg := &Config{
+		URI: DefaultURI,
+
+		AppName:       DefaultAppName,
+		AppVersion:    Version,
+		ClientVersion: ClientVersion,
+		Capabilities:  DefaultClientCapabilities,
+
+		HTTPTimeout:             10 * time.Second,
+		HTTPDialTimeout:         30 * time.Second,
+		HTTPKeepAlive:           120 * time.Second,
+		HTTPIdleConnTimeout:     90 * time.Second,
+		HTTPMaxIdleConns:        100,
+		HTTPMaxIdleConnsPerHost: 100,
+		HTTPDualStack:           true,
+
+		UnixDialTimeout:     DefaultUnixDialer.Timeout,
+		UnixMaxConnections:  DefaultUnixMaxConnections,
+		UnixIdleConnTimeout: DefaultUnixIdleConnTimeout,
+
+		SessionAutorefreshInterval: SessionAutorefreshInterval,
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+// WithEnvironment returns an Option which applies the settings found in the
+// KOPANO_SERVER_DEFAULT_URI, KCC_GO_DEBUG and KCC_GO_HTTP_* environment
+// variables. Invalid values are ignored.
+func WithEnvironment() Option {
+	return func(cfg *Config) {
+		cfg.loadEnvironment(os.LookupEnv)
+	}
+}
+
+// WithHTTPClient returns an Option which sets the http.Client used for HTTP
+// SOAP requests. All other HTTP settings except proxy and TLS settings are
+// ignored when set.
+func WithHTTPClient(client *http.Client) Option {
+	return func(cfg *Config) {
+		cfg.HTTPClient = client
+	}
+}
+
+// WithHTTPTimeout returns an Option which sets the HTTP request timeout.
+func WithHTTPTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.HTTPTimeout = timeout
+	}
+}
+
+// WithHTTPDialTimeout returns an Option which sets the HTTP dial timeout.
+func WithHTTPDialTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.HTTPDialTimeout = timeout
+	}
+}
+
+// WithHTTPKeepAlive returns an Option which sets the HTTP TCP keep-alive
+// interval.
+func WithHTTPKeepAlive(interval time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.HTTPKeepAlive = interval
+	}
+}
+
+// WithHTTPIdleConnTimeout returns an Option which sets how long idle HTTP
+// connections are kept open.
+func WithHTTPIdleConnTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.HTTPIdleConnTimeout = timeout
+	}
+}
+
+// WithHTTPMaxIdleConns returns an Option which sets the maximum number of idle
+// HTTP connections in total and per host.
+func WithHTTPMaxIdleConns(total, perHost int) Option {
+	return func(cfg *Config) {
+		cfg.HTTPMaxIdleConns = total
+		cfg.HTTPMaxIdleConnsPerHost = perHost
+	}
+}
+
+// WithHTTPDualStack returns an Option which enables or disables RFC 6555 Fast
+// Fallback for HTTP connections.
+func WithHTTPDualStack(enabled bool) Option {
+	return func(cfg *Config) {
+		cfg.HTTPDualStack = enabled
+	}
+}
+
+// WithHTTPProxy returns an Option which sets the HTTP or SOCKS5 proxy used
+// for HTTP SOAP requests.
+func WithHTTPProxy(proxy *url.URL) Option {
+	return func(cfg *Config) {
+		cfg.HTTPProxy = proxy
+	}
+}
+
+// WithTLSClientConfig returns an Option which sets the TLS configuration used
+// for https server URIs.
+func WithTLSClientConfig(config *tls.Config) Option {
+	return func(cfg *Config) {
+		cfg.TLSClientConfig = config
+	}
+}
+
+// WithRootCAs returns an Option which sets the root CAs trusted for https
+// server URIs instead of the system roots.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(cfg *Config) {
+		cfg.RootCAs = pool
+	}
+}
+
+// WithPinnedSPKI returns an Option which only accepts https servers with a
+// certificate chain containing a public key matching one of the provided
+// base64 encoded SHA-256 hashes.
+func WithPinnedSPKI(pins ...string) Option {
+	return func(cfg *Config) {
+		cfg.PinnedSPKI = pins
+	}
+}
+
+// WithUnixDialTimeout returns an Option which sets the timeout used for unix
+// socket connections.
+func WithUnixDialTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.UnixDialTimeout = timeout
+	}
+}
+
+// WithUnixMaxConnections returns an Option which sets the maximum number of
+// unix socket connections used for parallel requests.
+func WithUnixMaxConnections(n int) Option {
+	return func(cfg *Config) {
+		cfg.UnixMaxConnections = n
+	}
+}
+
+// WithUnixIdleConnTimeout returns an Option which sets the duration after
+// which idle unix socket connections are closed.
+func WithUnixIdleConnTimeout(timeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.UnixIdleConnTimeout = timeout
+	}
+}
+
+// WithMaxResponseSize returns an Option which sets the maximum size in bytes
+// of SOAP responses. Negative values disable the limit.
+func WithMaxResponseSize(size int64) Option {
+	return func(cfg *Config) {
+		cfg.MaxResponseSize = size
+	}
+}
+
+// WithMaxResponseDepth returns an Option which sets the maximum XML element
+// nesting depth of SOAP responses. Negative values disable the limit.
+func WithMaxResponseDepth(depth int) Option {
+	return func(cfg *Config) {
+		cfg.MaxResponseDepth = depth
+	}
+}
+
+// WithCompression returns an Option which enables gzip compression of SOAP
+// requests and responses with the provided settings.
+func WithCompression(compression *SOAPCompression) Option {
+	return func(cfg *Config) {
+		cfg.Compression = compression
+	}
+}
+
+// WithConcurrencyLimit returns an Option which limits the number of parallel
+// SOAP requests to maxInFlight, with up to maxQueue requests waiting. A
+// negative maxQueue allows an unlimited number of waiting requests.
+func WithConcurrencyLimit(maxInFlight, maxQueue int) Option {
+	return func(cfg *Config) {
+		cfg.MaxInFlight = maxInFlight
+		cfg.MaxQueue = maxQueue
+	}
+}
+
+// WithCircuitBreaker returns an Option which enables a circuit breaker that
+// fails requests fast for openTimeout after failureThreshold consecutive
+// requests failed.
+func WithCircuitBreaker(failureThreshold int, openTimeout time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.CircuitBreakerThreshold = failureThreshold
+		cfg.CircuitBreakerOpenTimeout = openTimeout
+	}
+}
+
+// WithClientApp returns an Option which sets the client app details as sent
+// to the server.
+func WithClientApp(name, version string) Option {
+	return func(cfg *Config) {
+		cfg.AppName = name
+		cfg.AppVersion = version
+	}
+}
+
+// WithClientVersion returns an Option which sets the client API version as
+// sent to the server.
+func WithClientVersion(version int) Option {
+	return func(cfg *Config) {
+		cfg.ClientVersion = version
+	}
+}
+
+// WithCapabilities returns an Option which sets the client capabilities.
+func WithCapabilities(capabilities KCFlag) Option {
+	return func(cfg *Config) {
+		cfg.Capabilities = capabilities
+	}
+}
+
+// WithSessionAutorefreshInterval returns an Option which sets the interval in
+// which sessions are refreshed automatically.
+func WithSessionAutorefreshInterval(interval time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.SessionAutorefreshInterval = interval
+	}
+}
+
+// WithLogger returns an Option which sets the Logger of the SOAP client.
+func WithLogger(logger Logger) Option {
+	return func(cfg *Config) {
+		cfg.Logger = logger
+	}
+}
+
+// New constructs a KCC instance for the provided URI with a Config created
+// from the provided options. If no URI is passed, the URI of the Config is
+// used. An error is returned when the URI is not a valid kcc URI.
+func New(uri *url.URL, opts ...Option) (*KCC, error) {
+	return NewConfig(opts...).NewKCC(uri)
+}
+
+// NewKCC constructs a KCC instance for the provided URI using the settings of
+// the accociated Config. If no URI is passed, the URI of the Config is used.
+func (cfg *Config) NewKCC(uri *url.URL) (*KCC, error) {
+	if uri == nil {
+		var err error
+		uri, err = url.Parse(cfg.URI)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil && (uri.Scheme == "http" || uri.Scheme == "https") {
+		var err error
+		httpClient, err = cfg.newHTTPClient()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	soap, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		HTTPClient: httpClient,
+		SocketDialer: &net.Dialer{
+			Timeout: cfg.UnixDialTimeout,
+		},
+		Proxy:               cfg.HTTPProxy,
+		TLSClientConfig:     cfg.TLSClientConfig,
+		RootCAs:             cfg.RootCAs,
+		PinnedSPKI:          cfg.PinnedSPKI,
+		UnixMaxConnections:  cfg.UnixMaxConnections,
+		UnixIdleConnTimeout: cfg.UnixIdleConnTimeout,
+		MaxResponseSize:     cfg.MaxResponseSize,
+		MaxResponseDepth:    cfg.MaxResponseDepth,
+		Compression:         cfg.Compression,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.CircuitBreakerThreshold > 0 {
+		soap = NewCircuitBreakerSOAPClient(soap, cfg.CircuitBreakerThreshold, cfg.CircuitBreakerOpenTimeout)
+	}
+	if cfg.MaxInFlight > 0 {
+		soap, err = NewLimitingSOAPClient(soap, cfg.MaxInFlight, cfg.MaxQueue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c := NewKCCWithClient(soap)
+	c.app = [2]string{cfg.AppName, cfg.AppVersion}
+	c.clientVersion = cfg.ClientVersion
+	c.Capabilities = cfg.Capabilities
+	c.sessionAutorefreshInterval = cfg.SessionAutorefreshInterval
+	if cfg.Logger != nil {
+		c.SetLogger(cfg.Logger)
+	}
+
+	return c, nil
+}
+
+// newHTTPTransport creates a new http.Transport from the HTTP settings of the
+// accociated Config.
+func (cfg *Config) newHTTPTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   cfg.HTTPDialTimeout,
+		KeepAlive: cfg.HTTPKeepAlive,
+		DualStack: cfg.HTTPDualStack,
+	}).DialContext
+	transport.MaxIdleConns = cfg.HTTPMaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.HTTPMaxIdleConnsPerHost
+	transport.IdleConnTimeout = cfg.HTTPIdleConnTimeout
+
+	return transport
+}
+
+// newHTTPClient creates a new http.Client with cookie jar from the HTTP
+// settings of the accociated Config.
+func (cfg *Config) newHTTPClient() (*http.Client, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{
+		PublicSuffixList: publicsuffix.List,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Jar:       jar,
+		Timeout:   cfg.HTTPTimeout,
+		Transport: cfg.newHTTPTransport(),
+	}, nil
+}
+
+// loadEnvironment applies the settings found with the provided lookup
+// function to the accociated Config.
+func (cfg *Config) loadEnvironment(lookup func(string) (string, bool)) {
+	seconds := func(key string, target *time.Duration) {
+		if s, ok := lookup(key); ok && s != "" {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				*target = time.Duration(n) * time.Second
+			}
+		}
+	}
+	number := func(key string, target *int) {
+		if s, ok := lookup(key); ok && s != "" {
+			if n, err := strconv.ParseInt(s, 10, 0); err == nil {
+				*target = int(n)
+			}
+		}
+	}
+
+	if s, ok := lookup("KOPANO_SERVER_DEFAULT_URI"); ok && s != "" {
+		cfg.URI = s
+	}
+	if s, ok := lookup("KCC_GO_DEBUG"); ok && s != "" {
+		cfg.Logger = NewWriterLogger(os.Stdout, LogLevelDebug)
+	}
+
+	seconds("KCC_GO_HTTP_TIMEOUT", &cfg.HTTPTimeout)
+	number("KCC_GO_HTTP_MAX_IDLE_CONNS", &cfg.HTTPMaxIdleConns)
+	number("KCC_GO_HTTP_MAX_IDLE_CONNS_PER_HOST", &cfg.HTTPMaxIdleConnsPerHost)
+	seconds("KCC_GO_HTTP_IDLE_CONN_TIMEOUT", &cfg.HTTPIdleConnTimeout)
+	seconds("KCC_GO_HTTP_DIAL_TIMEOUT", &cfg.HTTPDialTimeout)
+	seconds("KCC_GO_HTTP_KEEPALIVE", &cfg.HTTPKeepAlive)
+	if s, ok := lookup("KCC_GO_HTTP_DUALSTACK"); ok {
+		switch s {
+		case "off", "false", "no":
+			cfg.HTTPDualStack = false
+		case "on", "true", "yes":
+			cfg.HTTPDualStack = true
+		}
+	}
+}
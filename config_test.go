@@ -0,0 +1,120 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigLoadEnvironment(t *testing.T) {
+	env := map[string]string{
+		"KOPANO_SERVER_DEFAULT_URI":  "file:///run/kopano/server.sock",
+		"KCC_GO_HTTP_TIMEOUT":        "5",
+		"KCC_GO_HTTP_MAX_IDLE_CONNS": "invalid",
+		"KCC_GO_HTTP_DUALSTACK":      "off",
+	}
+	cfg := NewConfig()
+	cfg.loadEnvironment(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+
+	if cfg.URI != "file:///run/kopano/server.sock" {
+		t.Errorf("unexpected URI: %s", cfg.URI)
+	}
+	if cfg.HTTPTimeout != 5*time.Second {
+		t.Errorf("unexpected HTTP timeout: %v", cfg.HTTPTimeout)
+	}
+	if cfg.HTTPMaxIdleConns != 100 {
+		t.Errorf("invalid value was not ignored: %d", cfg.HTTPMaxIdleConns)
+	}
+	if cfg.HTTPDualStack {
+		t.Errorf("HTTP dual stack not disabled")
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	var payload string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		payload = string(body)
+		fmt.Fprint(rw, testSOAPResponse("<ns:logonResponse><er>0</er><ulSessionId>1</ulSessionId></ns:logonResponse>"))
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	c1, err := New(uri, WithHTTPTimeout(time.Second), WithClientApp("app1", "1.0"), WithClientVersion(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := New(uri, WithHTTPTimeout(2*time.Second), WithSessionAutorefreshInterval(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if timeout := c1.Client.(*SOAPHTTPClient).Client.Timeout; timeout != time.Second {
+		t.Errorf("unexpected HTTP timeout of first client: %v", timeout)
+	}
+	if timeout := c2.Client.(*SOAPHTTPClient).Client.Timeout; timeout != 2*time.Second {
+		t.Errorf("unexpected HTTP timeout of second client: %v", timeout)
+	}
+	if c2.autorefreshInterval() != time.Minute || c1.autorefreshInterval() != 4*time.Minute {
+		t.Errorf("unexpected session autorefresh intervals: %v, %v", c1.autorefreshInterval(), c2.autorefreshInterval())
+	}
+
+	if _, err = c1.Logon(context.Background(), "user1", "pass", 0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(payload, "<szClientApp>app1</szClientApp>") || !strings.Contains(payload, "<clientVersion>9</clientVersion>") {
+		t.Errorf("client settings not sent: %s", payload)
+	}
+}
+
+func TestNewConfigDefaults(t *testing.T) {
+	defer func(appName string, clientVersion int) {
+		DefaultAppName = appName
+		ClientVersion = clientVersion
+	}(DefaultAppName, ClientVersion)
+	DefaultAppName = "app2"
+	ClientVersion = 10
+
+	cfg := NewConfig()
+	if cfg.URI != DefaultURI || cfg.AppName != "app2" || cfg.ClientVersion != 10 || cfg.UnixMaxConnections != DefaultUnixMaxConnections {
+		t.Errorf("package defaults not used: %+v", cfg)
+	}
+
+	var payload string
+	c := NewKCCWithClient(testSOAPClient(func(ctx context.Context, p *string, v interface{}) error {
+		payload = *p
+		return nil
+	}))
+	ClientVersion = 11
+	if _, err := c.Logon(context.Background(), "user1", "pass", 0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(payload, "<clientVersion>11</clientVersion>") {
+		t.Errorf("current client version not sent: %s", payload)
+	}
+}
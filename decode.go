@@ -0,0 +1,139 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+var (
+	// DefaultMaxResponseSize is the maximum size in bytes of SOAP responses
+	// used by SOAP clients which have no MaxResponseSize set.
+	DefaultMaxResponseSize int64 = 64 * 1024 * 1024
+	// DefaultMaxResponseDepth is the maximum XML element nesting depth of SOAP
+	// responses used by SOAP clients which have no MaxResponseDepth set.
+	DefaultMaxResponseDepth = 64
+)
+
+var (
+	// ErrResponseTooLarge is the error returned when a SOAP response exceeds
+	// the maximum response size.
+	ErrResponseTooLarge = errors.New("response exceeds maximum size")
+	// ErrResponseTooDeep is the error returned when a SOAP response exceeds
+	// the maximum element depth.
+	ErrResponseTooDeep = errors.New("response exceeds maximum element depth")
+)
+
+// responseLimits hold the limits applied when decoding SOAP responses. Zero
+// values mean unlimited.
+type responseLimits struct {
+	maxSize  int64
+	maxDepth int
+}
+
+// newResponseLimits returns the responseLimits for the provided values,
+// replacing zero values with the package defaults. Negative values disable
+// the corresponding limit.
+func newResponseLimits(maxSize int64, maxDepth int) responseLimits {
+	if maxSize == 0 {
+		maxSize = DefaultMaxResponseSize
+	}
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxResponseDepth
+	}
+	if maxSize < 0 {
+		maxSize = 0
+	}
+	if maxDepth < 0 {
+		maxDepth = 0
+	}
+
+	return responseLimits{
+		maxSize:  maxSize,
+		maxDepth: maxDepth,
+	}
+}
+
+// reader returns a reader which reads from the provided reader and fails with
+// ErrResponseTooLarge when more than the maximum size is read.
+func (l responseLimits) reader(r io.Reader) io.Reader {
+	if l.maxSize <= 0 {
+		return r
+	}
+	return &sizeLimitedReader{
+		r: r,
+		n: l.maxSize,
+	}
+}
+
+// decoder returns a xml.Decoder for the provided reader which fails with
+// ErrResponseTooDeep when elements are nested deeper than the maximum depth.
+func (l responseLimits) decoder(r io.Reader) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	if l.maxDepth <= 0 {
+		return decoder
+	}
+	return xml.NewTokenDecoder(&depthLimitedTokenReader{
+		d:        decoder,
+		maxDepth: l.maxDepth,
+	})
+}
+
+// A sizeLimitedReader reads from r and fails if more than n bytes are read.
+type sizeLimitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (lr *sizeLimitedReader) Read(p []byte) (int, error) {
+	if lr.n < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > lr.n+1 {
+		p = p[:lr.n+1]
+	}
+	n, err := lr.r.Read(p)
+	lr.n -= int64(n)
+	if lr.n < 0 {
+		return n + int(lr.n), ErrResponseTooLarge
+	}
+	return n, err
+}
+
+// A depthLimitedTokenReader reads tokens from d and fails if elements are
+// nested deeper than maxDepth.
+type depthLimitedTokenReader struct {
+	d        *xml.Decoder
+	depth    int
+	maxDepth int
+}
+
+func (tr *depthLimitedTokenReader) Token() (xml.Token, error) {
+	t, err := tr.d.Token()
+	switch t.(type) {
+	case xml.StartElement:
+		tr.depth++
+		if tr.depth > tr.maxDepth {
+			return nil, ErrResponseTooDeep
+		}
+	case xml.EndElement:
+		tr.depth--
+	}
+	return t, err
+}
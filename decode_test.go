@@ -0,0 +1,105 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newTestSOAPHTTPClient(t *testing.T, body string) (*SOAPHTTPClient, func()) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(rw, testSOAPResponse(body))
+	}))
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return client, srv.Close
+}
+
+func TestResponseLimits(t *testing.T) {
+	body := "<ns:resolveUsernameResponse><er>0</er><ulUserId>1</ulUserId><sUserId>" + strings.Repeat("A", 1024) + "</sUserId></ns:resolveUsernameResponse>"
+	client, done := newTestSOAPHTTPClient(t, body)
+	defer done()
+	c := NewKCCWithClient(client)
+
+	if _, err := c.ResolveUsername(context.Background(), "user1", 1); err != nil {
+		t.Errorf("unexpected error with default limits: %v", err)
+	}
+
+	client.MaxResponseSize = 512
+	if _, err := c.ResolveUsername(context.Background(), "user1", 1); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("expected response too large error, got %v", err)
+	}
+
+	client.MaxResponseSize = 0
+	client.MaxResponseDepth = 3
+	if _, err := c.ResolveUsername(context.Background(), "user1", 1); !errors.Is(err, ErrResponseTooDeep) {
+		t.Errorf("expected response too deep error, got %v", err)
+	}
+
+	client.MaxResponseDepth = -1
+	if _, err := c.ResolveUsername(context.Background(), "user1", 1); err != nil {
+		t.Errorf("unexpected error without depth limit: %v", err)
+	}
+}
+
+func TestABResolveNamesStream(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("<ns:abResolveNamesResponse><er>0</er><sRowSet>")
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&b, "<item><item><ulPropTag>%d</ulPropTag><lpszA>user%d</lpszA></item></item>", PR_ACCOUNT_A, i)
+	}
+	b.WriteString("</sRowSet><aFlags><item>2</item></aFlags></ns:abResolveNamesResponse>")
+
+	client, done := newTestSOAPHTTPClient(t, b.String())
+	defer done()
+	c := NewKCCWithClient(client)
+
+	var names []string
+	response, err := c.ABResolveNamesStream(context.Background(), []PT{PR_ACCOUNT_A}, map[PT]interface{}{PR_ACCOUNT_A: "user"}, 0, 1, 0, func(row *PropTagRowSet) error {
+		names = append(names, row.PropTagValues[0].AStringValue)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.RowSet.Count != 3 || len(names) != 3 || names[2] != "user2" {
+		t.Errorf("unexpected rows: %v", names)
+	}
+	if len(response.Flags) != 1 || response.Flags[0] != 2 {
+		t.Errorf("unexpected flags: %v", response.Flags)
+	}
+
+	stop := errors.New("stop")
+	_, err = c.ABResolveNamesStream(context.Background(), []PT{PR_ACCOUNT_A}, map[PT]interface{}{PR_ACCOUNT_A: "user"}, 0, 1, 0, func(row *PropTagRowSet) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("expected handler error, got %v", err)
+	}
+}
@@ -0,0 +1,579 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Version numbers as used by Kopano EID implementations.
+const (
+	EIDV1VersionNumber = 1
+)
+
+// One-off EntryID flags as defined in mapi4linux/include/mapidefs.h. This only
+// defines the flags actually used or understood by kcc-go.
+const (
+	MAPI_ONE_OFF_NO_RICH_INFO uint16 = 0x0001
+	MAPI_ONE_OFF_UNICODE      uint16 = 0x8000
+)
+
+// EntryID defines the common public interface for all EntryIDs known to
+// kcc-go.
+type EntryID interface {
+	ABFlags() byte
+	GUID() GUID
+	Bytes() []byte
+	String() string
+	Hex() string
+}
+
+// OneOffEID defines the public interface for one-off EntryIDs which carry the
+// recipient details directly inside the EntryID.
+type OneOffEID interface {
+	EntryID
+	Flags() uint16
+	DisplayName() string
+	AddressType() string
+	EmailAddress() string
+}
+
+// ContabEID defines the public interface for Kopano contact provider EntryIDs.
+type ContabEID interface {
+	EntryID
+	Type() MAPIType
+	Offset() uint32
+	OriginalEntryID() []byte
+}
+
+// StoreEID defines the public interface for Kopano store EntryIDs.
+type StoreEID interface {
+	EntryID
+	StoreGUID() GUID
+	UniqueID() GUID
+	ServerURL() string
+	ProviderDLL() string
+}
+
+// MessageEID defines the public interface for Kopano message EntryIDs.
+type MessageEID interface {
+	EntryID
+	StoreGUID() GUID
+	UniqueID() GUID
+	ServerURL() string
+}
+
+// An entryIDHeader is the byte representation of the start of any EntryID.
+type entryIDHeader struct {
+	ABFlags [4]byte
+	GUID    GUID
+}
+
+// A oneOffEID defines a one-off EntryID as specified in
+// https://docs.microsoft.com/en-us/openspecs/exchange_server_protocols/ms-oxcdata/.
+type oneOffEID struct {
+	header *entryIDHeader
+	data   *oneOffEIDData
+
+	displayName  string
+	addressType  string
+	emailAddress string
+}
+
+// oneOffEIDData define the fixed size values following the header of one-off
+// EntryIDs.
+type oneOffEIDData struct {
+	Version uint16
+	Flags   uint16
+	/* Rest are null terminated strings of arbitrary size */
+}
+
+// ABFlags returns the first byte of the associated EntryIDs abflag data.
+func (eid *oneOffEID) ABFlags() byte {
+	return eid.header.ABFlags[0]
+}
+
+// GUID returns the associated EntryID GUID value.
+func (eid *oneOffEID) GUID() GUID {
+	return eid.header.GUID
+}
+
+// Flags returns the associated one-off EntryID flags.
+func (eid *oneOffEID) Flags() uint16 {
+	return eid.data.Flags
+}
+
+// DisplayName returns the associated one-off EntryID display name.
+func (eid *oneOffEID) DisplayName() string {
+	return eid.displayName
+}
+
+// AddressType returns the associated one-off EntryID address type.
+func (eid *oneOffEID) AddressType() string {
+	return eid.addressType
+}
+
+// EmailAddress returns the associated one-off EntryID email address.
+func (eid *oneOffEID) EmailAddress() string {
+	return eid.emailAddress
+}
+
+// Bytes returns the associated EntryID's binary representation.
+func (eid *oneOffEID) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, eid.header)
+	binary.Write(buf, binary.LittleEndian, eid.data)
+	unicode := eid.data.Flags&MAPI_ONE_OFF_UNICODE != 0
+	for _, s := range []string{eid.displayName, eid.addressType, eid.emailAddress} {
+		if unicode {
+			binary.Write(buf, binary.LittleEndian, utf16.Encode([]rune(s)))
+			buf.Write([]byte{0, 0})
+		} else {
+			buf.WriteString(s)
+			buf.WriteByte(0)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func (eid *oneOffEID) String() string {
+	return base64.StdEncoding.EncodeToString(eid.Bytes())
+}
+
+func (eid *oneOffEID) Hex() string {
+	return hex.EncodeToString(eid.Bytes())
+}
+
+// A contabEID defines a Kopano contact provider EntryID as defined in
+// provider/contacts/ZCABData.h.
+type contabEID struct {
+	header *entryIDHeader
+	data   *contabEIDData
+
+	origEntryID []byte
+}
+
+// contabEIDData define the fixed size values following the header of contact
+// provider EntryIDs.
+type contabEIDData struct {
+	Type   MAPIType
+	Offset uint32
+	/* Rest is the original EntryID of arbitrary size */
+}
+
+// ABFlags returns the first byte of the associated EntryIDs abflag data.
+func (eid *contabEID) ABFlags() byte {
+	return eid.header.ABFlags[0]
+}
+
+// GUID returns the associated EntryID GUID value.
+func (eid *contabEID) GUID() GUID {
+	return eid.header.GUID
+}
+
+// Type returns the associated EntryID Type.
+func (eid *contabEID) Type() MAPIType {
+	return eid.data.Type
+}
+
+// Offset returns the associated EntryID offset, which selects the email
+// address of the contact.
+func (eid *contabEID) Offset() uint32 {
+	return eid.data.Offset
+}
+
+// OriginalEntryID returns the EntryID of the contact or distribution list
+// wrapped by the associated EntryID.
+func (eid *contabEID) OriginalEntryID() []byte {
+	return eid.origEntryID
+}
+
+// Bytes returns the associated EntryID's binary representation.
+func (eid *contabEID) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, eid.header)
+	binary.Write(buf, binary.LittleEndian, eid.data)
+	buf.Write(eid.origEntryID)
+
+	return buf.Bytes()
+}
+
+func (eid *contabEID) String() string {
+	return base64.StdEncoding.EncodeToString(eid.Bytes())
+}
+
+func (eid *contabEID) Hex() string {
+	return hex.EncodeToString(eid.Bytes())
+}
+
+// A kcEIDV1 defines a Kopano object EntryID of version 1 as defined in
+// provider/include/kcore.hpp. If the EntryID was wrapped, the wrapping data is
+// kept to be able to return the original representation.
+type kcEIDV1 struct {
+	wrap   *storeWrapData
+	header *entryIDHeader
+	dataV1 *kcEIDV1Data
+
+	serverURL string
+}
+
+// kcEIDV1Data define further values as defined in provider/include/kcore.hpp
+// for version 1 EID structs.
+type kcEIDV1Data struct {
+	Version  uint32
+	Type     uint16
+	Flags    uint16
+	UniqueID GUID
+	/* Rest is the null terminated server URL of arbitrary size */
+}
+
+// A storeWrapData holds the values of a store EntryID wrapped as described in
+// https://docs.microsoft.com/en-us/office/client-developer/outlook/mapi/wrapstoreentryid.
+type storeWrapData struct {
+	header      *entryIDHeader
+	version     byte
+	flags       byte
+	providerDLL string
+}
+
+// ABFlags returns the first byte of the associated EntryIDs abflag data.
+func (eid *kcEIDV1) ABFlags() byte {
+	if eid.wrap != nil {
+		return eid.wrap.header.ABFlags[0]
+	}
+	return eid.header.ABFlags[0]
+}
+
+// GUID returns the associated EntryID GUID value. For wrapped EntryIDs this
+// is the GUID of the wrapper.
+func (eid *kcEIDV1) GUID() GUID {
+	if eid.wrap != nil {
+		return eid.wrap.header.GUID
+	}
+	return eid.header.GUID
+}
+
+// StoreGUID returns the GUID of the store the associated EntryID refers to.
+func (eid *kcEIDV1) StoreGUID() GUID {
+	return eid.header.GUID
+}
+
+// UniqueID returns the associated EntryID unique object ID.
+func (eid *kcEIDV1) UniqueID() GUID {
+	return eid.dataV1.UniqueID
+}
+
+// ServerURL returns the server URL as stored in the associated EntryID.
+func (eid *kcEIDV1) ServerURL() string {
+	return eid.serverURL
+}
+
+// ProviderDLL returns the provider DLL name of a wrapped EntryID or an empty
+// string if the associated EntryID is not wrapped.
+func (eid *kcEIDV1) ProviderDLL() string {
+	if eid.wrap != nil {
+		return eid.wrap.providerDLL
+	}
+	return ""
+}
+
+// Bytes returns the associated EntryID's binary representation.
+func (eid *kcEIDV1) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	if eid.wrap != nil {
+		binary.Write(buf, binary.LittleEndian, eid.wrap.header)
+		buf.WriteByte(eid.wrap.version)
+		buf.WriteByte(eid.wrap.flags)
+		buf.WriteString(eid.wrap.providerDLL)
+		buf.WriteByte(0)
+		buf.Write(make([]byte, padding4(buf.Len())))
+	}
+	start := buf.Len()
+	binary.Write(buf, binary.LittleEndian, eid.header)
+	binary.Write(buf, binary.LittleEndian, eid.dataV1)
+	buf.WriteString(eid.serverURL)
+	buf.WriteByte(0)
+	buf.Write(make([]byte, padding4(buf.Len()-start)))
+
+	return buf.Bytes()
+}
+
+func (eid *kcEIDV1) String() string {
+	return base64.StdEncoding.EncodeToString(eid.Bytes())
+}
+
+func (eid *kcEIDV1) Hex() string {
+	return hex.EncodeToString(eid.Bytes())
+}
+
+// A storeEIDV1 is a Kopano store EntryID.
+type storeEIDV1 struct {
+	*kcEIDV1
+}
+
+// A messageEIDV1 is a Kopano message EntryID.
+type messageEIDV1 struct {
+	*kcEIDV1
+}
+
+// NewEntryIDFromBytes takes a byte value and returns the EntryID represented
+// by those bytes. The returned value implements the interface matching the
+// provider of the EntryID, thus is either an ABEID, OneOffEID, ContabEID,
+// StoreEID or MessageEID.
+func NewEntryIDFromBytes(value []byte) (EntryID, error) {
+	reader := bytes.NewReader(value)
+
+	var header entryIDHeader
+	err := binary.Read(reader, binary.LittleEndian, &header)
+	if err != nil {
+		return nil, err
+	}
+
+	switch header.GUID {
+	case MUIDECSAB:
+		return NewABEIDFromBytes(value)
+	case MUIDOneOff:
+		return newOneOffEIDFromBytes(&header, value[len(value)-reader.Len():])
+	case MUIDZCSAB:
+		return newContabEIDFromBytes(&header, value[len(value)-reader.Len():])
+	case MUIDStoreWrap:
+		return newWrappedStoreEIDFromBytes(&header, value[len(value)-reader.Len():])
+	default:
+		// Kopano object EntryIDs have the GUID of their store in the header,
+		// thus they can only be detected by their content.
+		return newKCEIDFromBytes(nil, &header, value[len(value)-reader.Len():])
+	}
+}
+
+// NewEntryIDFromHex takes a hex encoded byte value and returns the EntryID
+// represented by those bytes.
+func NewEntryIDFromHex(hexValue []byte) (EntryID, error) {
+	value := make([]byte, hex.DecodedLen(len(hexValue)))
+
+	if _, err := hex.Decode(value, hexValue); err != nil {
+		return nil, err
+	}
+
+	return NewEntryIDFromBytes(value)
+}
+
+// NewEntryIDFromBase64 takes a base64Std encoded byte value and returns the
+// EntryID represented by those bytes.
+func NewEntryIDFromBase64(base64Value []byte) (EntryID, error) {
+	value := make([]byte, base64.StdEncoding.DecodedLen(len(base64Value)))
+
+	n, err := base64.StdEncoding.Decode(value, base64Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEntryIDFromBytes(value[:n])
+}
+
+// NewOneOffEID creates a new one-off EntryID from the provided values. When
+// the provided flags contain MAPI_ONE_OFF_UNICODE, the strings are encoded as
+// UTF-16, otherwise they are stored as is.
+func NewOneOffEID(displayName, addressType, emailAddress string, flags uint16) (OneOffEID, error) {
+	if addressType == "" {
+		return nil, fmt.Errorf("one-off EntryID requires an address type")
+	}
+
+	eid := &oneOffEID{
+		header: &entryIDHeader{
+			GUID: MUIDOneOff,
+		},
+		data: &oneOffEIDData{
+			Flags: flags,
+		},
+		displayName:  displayName,
+		addressType:  addressType,
+		emailAddress: emailAddress,
+	}
+
+	return eid, nil
+}
+
+// NewSMTPOneOffEID creates a new unicode one-off EntryID with SMTP address
+// type for the provided display name and email address.
+func NewSMTPOneOffEID(displayName, emailAddress string) (OneOffEID, error) {
+	return NewOneOffEID(displayName, "SMTP", emailAddress, MAPI_ONE_OFF_UNICODE|MAPI_ONE_OFF_NO_RICH_INFO)
+}
+
+func newOneOffEIDFromBytes(header *entryIDHeader, value []byte) (OneOffEID, error) {
+	reader := bytes.NewReader(value)
+
+	var data oneOffEIDData
+	err := binary.Read(reader, binary.LittleEndian, &data)
+	if err != nil {
+		return nil, err
+	}
+	if data.Version != 0 {
+		return nil, fmt.Errorf("one-off EntryID unsupported version %d", data.Version)
+	}
+
+	rest := value[len(value)-reader.Len():]
+	strs := make([]string, 3)
+	for idx := range strs {
+		var s string
+		if data.Flags&MAPI_ONE_OFF_UNICODE != 0 {
+			s, rest, err = readUTF16String(rest)
+		} else {
+			s, rest, err = readString(rest)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("one-off EntryID invalid string value: %v", err)
+		}
+		strs[idx] = s
+	}
+
+	eid := &oneOffEID{
+		header: header,
+		data:   &data,
+
+		displayName:  strs[0],
+		addressType:  strs[1],
+		emailAddress: strs[2],
+	}
+
+	return eid, nil
+}
+
+func newContabEIDFromBytes(header *entryIDHeader, value []byte) (ContabEID, error) {
+	reader := bytes.NewReader(value)
+
+	var data contabEIDData
+	err := binary.Read(reader, binary.LittleEndian, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	origEntryID := make([]byte, reader.Len())
+	copy(origEntryID, value[len(value)-reader.Len():])
+
+	eid := &contabEID{
+		header: header,
+		data:   &data,
+
+		origEntryID: origEntryID,
+	}
+
+	return eid, nil
+}
+
+func newWrappedStoreEIDFromBytes(header *entryIDHeader, value []byte) (EntryID, error) {
+	if len(value) < 2 {
+		return nil, fmt.Errorf("wrapped store EntryID too short")
+	}
+
+	wrap := &storeWrapData{
+		header:  header,
+		version: value[0],
+		flags:   value[1],
+	}
+	providerDLL, rest, err := readString(value[2:])
+	if err != nil {
+		return nil, fmt.Errorf("wrapped store EntryID invalid provider DLL value: %v", err)
+	}
+	wrap.providerDLL = providerDLL
+
+	// Skip padding, which aligns the wrapped EntryID to 4 bytes.
+	offset := binary.Size(header) + len(value) - len(rest)
+	pad := padding4(offset)
+	if len(rest) < pad {
+		return nil, fmt.Errorf("wrapped store EntryID too short")
+	}
+	rest = rest[pad:]
+
+	reader := bytes.NewReader(rest)
+	var innerHeader entryIDHeader
+	err = binary.Read(reader, binary.LittleEndian, &innerHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	return newKCEIDFromBytes(wrap, &innerHeader, rest[len(rest)-reader.Len():])
+}
+
+func newKCEIDFromBytes(wrap *storeWrapData, header *entryIDHeader, value []byte) (EntryID, error) {
+	reader := bytes.NewReader(value)
+
+	var data kcEIDV1Data
+	err := binary.Read(reader, binary.LittleEndian, &data)
+	if err != nil {
+		return nil, fmt.Errorf("EntryID unknown provider %v", header.GUID)
+	}
+	if data.Version != EIDV1VersionNumber {
+		return nil, fmt.Errorf("EntryID unknown provider %v or unsupported version %d", header.GUID, data.Version)
+	}
+
+	serverURL, _, err := readString(value[len(value)-reader.Len():])
+	if err != nil {
+		return nil, fmt.Errorf("EntryID invalid server URL value: %v", err)
+	}
+
+	eid := &kcEIDV1{
+		wrap:   wrap,
+		header: header,
+		dataV1: &data,
+
+		serverURL: serverURL,
+	}
+
+	switch MAPIType(data.Type) {
+	case MAPI_STORE:
+		return &storeEIDV1{eid}, nil
+	case MAPI_MESSAGE:
+		if wrap != nil {
+			return nil, fmt.Errorf("EntryID unexpected wrapped message")
+		}
+		return &messageEIDV1{eid}, nil
+	default:
+		return nil, fmt.Errorf("EntryID unsupported type %d", data.Type)
+	}
+}
+
+func readString(value []byte) (string, []byte, error) {
+	idx := bytes.IndexByte(value, 0)
+	if idx < 0 {
+		return "", nil, fmt.Errorf("missing string termination")
+	}
+
+	return string(value[:idx]), value[idx+1:], nil
+}
+
+func readUTF16String(value []byte) (string, []byte, error) {
+	var units []uint16
+	for idx := 0; idx+1 < len(value); idx += 2 {
+		unit := binary.LittleEndian.Uint16(value[idx:])
+		if unit == 0 {
+			return string(utf16.Decode(units)), value[idx+2:], nil
+		}
+		units = append(units, unit)
+	}
+
+	return "", nil, fmt.Errorf("missing string termination")
+}
+
+func padding4(size int) int {
+	return (4 - size%4) % 4
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEntryIDFromHexABEID(t *testing.T) {
+	value := "00000000ac21a95040d3ee48b319fba7533044250100000006000000040000004d673d3d"
+
+	eid, err := NewEntryIDFromHex([]byte(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	abeid, ok := eid.(ABEID)
+	if !ok {
+		t.Fatalf("EntryID unexpected type %T, wanted ABEID", eid)
+	}
+	if abeid.ID() != 4 {
+		t.Errorf("EntryID ABEID unexpected ID value: %v", abeid.ID())
+	}
+	if abeid.Hex() != value {
+		t.Errorf("EntryID ABEID hex value mismatch got %v, wanted %v", abeid.Hex(), value)
+	}
+}
+
+func TestEntryIDFromHexOneOff(t *testing.T) {
+	values := []string{
+		// ANSI.
+		"00000000812b1fa4bea310199d6e00dd010f54020000010055736572203100534d5450007573657231406b6f70616e6f2e6c6f63616c00",
+		// Unicode.
+		"00000000812b1fa4bea310199d6e00dd010f540200000180550073006500720020003100000053004d00540050000000" +
+			"7500730065007200310040006b006f00700061006e006f002e006c006f00630061006c000000",
+	}
+
+	for idx, value := range values {
+		eid, err := NewEntryIDFromHex([]byte(value))
+		if err != nil {
+			t.Errorf("EntryID(%d) %v", idx, err)
+			continue
+		}
+		oneOff, ok := eid.(OneOffEID)
+		if !ok {
+			t.Errorf("EntryID(%d) unexpected type %T, wanted OneOffEID", idx, eid)
+			continue
+		}
+		if oneOff.DisplayName() != "User 1" {
+			t.Errorf("EntryID(%d) unexpected display name: %v", idx, oneOff.DisplayName())
+		}
+		if oneOff.AddressType() != "SMTP" {
+			t.Errorf("EntryID(%d) unexpected address type: %v", idx, oneOff.AddressType())
+		}
+		if oneOff.EmailAddress() != "user1@kopano.local" {
+			t.Errorf("EntryID(%d) unexpected email address: %v", idx, oneOff.EmailAddress())
+		}
+		if oneOff.Hex() != value {
+			t.Errorf("EntryID(%d) hex value mismatch got %v, wanted %v", idx, oneOff.Hex(), value)
+		}
+	}
+}
+
+func TestNewSMTPOneOffEID(t *testing.T) {
+	a, err := NewSMTPOneOffEID("Jöhn Dœ", "john@kopano.local")
+	if err != nil {
+		t.Fatalf("NewSMTPOneOffEID failed with error: %v", err)
+	}
+
+	eid, err := NewEntryIDFromBase64([]byte(a.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, ok := eid.(OneOffEID)
+	if !ok {
+		t.Fatalf("EntryID unexpected type %T, wanted OneOffEID", eid)
+	}
+	if b.Flags() != MAPI_ONE_OFF_UNICODE|MAPI_ONE_OFF_NO_RICH_INFO {
+		t.Errorf("EntryID unexpected flags: %x", b.Flags())
+	}
+	if b.DisplayName() != "Jöhn Dœ" || b.EmailAddress() != "john@kopano.local" {
+		t.Errorf("EntryID round trip mismatch: %v <%v>", b.DisplayName(), b.EmailAddress())
+	}
+}
+
+func TestEntryIDContab(t *testing.T) {
+	orig := []byte{0, 0, 0, 0, 1, 2, 3, 4}
+	a := &contabEID{
+		header: &entryIDHeader{GUID: MUIDZCSAB},
+		data: &contabEIDData{
+			Type:   MAPI_MAILUSER,
+			Offset: 2,
+		},
+		origEntryID: orig,
+	}
+
+	eid, err := NewEntryIDFromBytes(a.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, ok := eid.(ContabEID)
+	if !ok {
+		t.Fatalf("EntryID unexpected type %T, wanted ContabEID", eid)
+	}
+	if b.Type() != MAPI_MAILUSER || b.Offset() != 2 {
+		t.Errorf("EntryID unexpected values: %v %v", b.Type(), b.Offset())
+	}
+	if !bytes.Equal(b.OriginalEntryID(), orig) {
+		t.Errorf("EntryID original EntryID mismatch: %v", b.OriginalEntryID())
+	}
+}
+
+func TestEntryIDStoreAndMessage(t *testing.T) {
+	storeGUID := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	store := &kcEIDV1{
+		wrap: &storeWrapData{
+			header:      &entryIDHeader{GUID: MUIDStoreWrap},
+			providerDLL: "zarafa6provider.dll",
+		},
+		header: &entryIDHeader{GUID: storeGUID},
+		dataV1: &kcEIDV1Data{
+			Version: EIDV1VersionNumber,
+			Type:    uint16(MAPI_STORE),
+		},
+		serverURL: "default:",
+	}
+	message := &kcEIDV1{
+		header: &entryIDHeader{GUID: storeGUID},
+		dataV1: &kcEIDV1Data{
+			Version:  EIDV1VersionNumber,
+			Type:     uint16(MAPI_MESSAGE),
+			UniqueID: [16]byte{1},
+		},
+	}
+
+	eid, err := NewEntryIDFromBytes(store.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := eid.(StoreEID)
+	if !ok {
+		t.Fatalf("EntryID unexpected type %T, wanted StoreEID", eid)
+	}
+	if s.GUID() != MUIDStoreWrap || s.StoreGUID() != storeGUID {
+		t.Errorf("EntryID store unexpected GUID values: %x %x", s.GUID(), s.StoreGUID())
+	}
+	if s.ProviderDLL() != "zarafa6provider.dll" || s.ServerURL() != "default:" {
+		t.Errorf("EntryID store unexpected values: %v %v", s.ProviderDLL(), s.ServerURL())
+	}
+	if !bytes.Equal(s.Bytes(), store.Bytes()) {
+		t.Errorf("EntryID store bytes mismatch")
+	}
+
+	eid, err = NewEntryIDFromBytes(message.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := eid.(MessageEID)
+	if !ok {
+		t.Fatalf("EntryID unexpected type %T, wanted MessageEID", eid)
+	}
+	if m.UniqueID() != message.dataV1.UniqueID {
+		t.Errorf("EntryID message unexpected unique ID value: %x", m.UniqueID())
+	}
+}
+
+func TestEntryIDUnknownProvider(t *testing.T) {
+	_, err := NewEntryIDFromHex([]byte("00000000ffffffffffffffffffffffffffffffff"))
+	if err == nil {
+		t.Error("EntryID with unknown provider decoded without error")
+	}
+}
@@ -17,7 +17,9 @@
 package kcc
 
 import (
+	"errors"
 	"fmt"
+	"net"
 )
 
 // KCError is an error as returned by Kopano core.
@@ -194,3 +196,74 @@ func KCErrorText(code KCError) string {
 	}
 	return text
 }
+
+// A MethodError wraps an error as returned by a SOAP method together with the
+// name of that method. Use errors.Is or errors.As to check the wrapped error,
+// for example for a specific KCError.
+type MethodError struct {
+	Method string
+	Err    error
+}
+
+// NewMethodError returns a MethodError for the provided SOAP method name and
+// KCError. It returns nil if the provided KCError signals success.
+func NewMethodError(method string, er KCError) error {
+	if er == KCSuccess {
+		return nil
+	}
+	return &MethodError{
+		Method: method,
+		Err:    er,
+	}
+}
+
+func (err *MethodError) Error() string {
+	return fmt.Sprintf("%s: %v", err.Method, err.Err)
+}
+
+// Unwrap returns the error wrapped by the associated MethodError.
+func (err *MethodError) Unwrap() error {
+	return err.Err
+}
+
+// IsTemporary returns true if the provided error or any error it wraps is a
+// KCError, HTTPStatusError or network error which indicates a temporary
+// condition, so that the failed request can be retried.
+func IsTemporary(err error) bool {
+	var kcErr KCError
+	if errors.As(err, &kcErr) {
+		switch kcErr {
+		case KCERR_NETWORK_ERROR,
+			KCERR_SERVER_NOT_RESPONDING,
+			KCERR_TIMEOUT,
+			KCERR_BUSY:
+			return true
+		}
+		return false
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+
+	return false
+}
+
+// IsAuthFailure returns true if the provided error or any error it wraps is a
+// KCError which signals failed authentication.
+func IsAuthFailure(err error) bool {
+	return errors.Is(err, KCERR_LOGON_FAILED)
+}
+
+// IsSessionEnded returns true if the provided error or any error it wraps is a
+// KCError which signals that the session used for a request does not exist
+// anymore.
+func IsSessionEnded(err error) bool {
+	return errors.Is(err, KCERR_END_OF_SESSION)
+}
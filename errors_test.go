@@ -0,0 +1,62 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMethodError(t *testing.T) {
+	if err := NewMethodError("logon", KCSuccess); err != nil {
+		t.Errorf("MethodError created for success: %v", err)
+	}
+
+	err := fmt.Errorf("refresh failed: %w", NewMethodError("resolveUsername", KCERR_END_OF_SESSION))
+	if !errors.Is(err, KCERR_END_OF_SESSION) {
+		t.Error("MethodError does not match wrapped KCError")
+	}
+
+	var methodErr *MethodError
+	if !errors.As(err, &methodErr) || methodErr.Method != "resolveUsername" {
+		t.Errorf("MethodError not found in error chain: %v", err)
+	}
+	var kcErr KCError
+	if !errors.As(err, &kcErr) || kcErr != KCERR_END_OF_SESSION {
+		t.Errorf("KCError not found in error chain: %v", err)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	wrap := func(er KCError) error {
+		return fmt.Errorf("wrapped: %w", NewMethodError("test", er))
+	}
+
+	if !IsSessionEnded(wrap(KCERR_END_OF_SESSION)) || IsSessionEnded(wrap(KCERR_NOT_FOUND)) {
+		t.Error("IsSessionEnded returned unexpected result")
+	}
+	if !IsAuthFailure(wrap(KCERR_LOGON_FAILED)) || IsAuthFailure(wrap(KCERR_NETWORK_ERROR)) {
+		t.Error("IsAuthFailure returned unexpected result")
+	}
+	if !IsTemporary(wrap(KCERR_NETWORK_ERROR)) || !IsTemporary(wrap(KCERR_BUSY)) || IsTemporary(wrap(KCERR_LOGON_FAILED)) {
+		t.Error("IsTemporary returned unexpected result")
+	}
+	if IsTemporary(errors.New("other")) {
+		t.Error("IsTemporary returned true for unrelated error")
+	}
+}
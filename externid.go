@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ObjectClass is the type representing object classes of Kopano user plugins.
+type ObjectClass uint32
+
+// Kopano object classes as defined in common/include/kopano/ECDefs.h. The
+// upper 16 bits hold the object type, the lower 16 bits the class within that
+// type.
+const (
+	OBJECTCLASS_UNKNOWN   ObjectClass = 0x00000000
+	OBJECTCLASS_USER      ObjectClass = 0x00010000
+	ACTIVE_USER           ObjectClass = 0x00010001
+	NONACTIVE_USER        ObjectClass = 0x00010002
+	NONACTIVE_ROOM        ObjectClass = 0x00010003
+	NONACTIVE_EQUIPMENT   ObjectClass = 0x00010004
+	NONACTIVE_CONTACT     ObjectClass = 0x00010005
+	OBJECTCLASS_DISTLIST  ObjectClass = 0x00030000
+	DISTLIST_GROUP        ObjectClass = 0x00030001
+	DISTLIST_SECURITY     ObjectClass = 0x00030002
+	DISTLIST_DYNAMIC      ObjectClass = 0x00030003
+	OBJECTCLASS_CONTAINER ObjectClass = 0x00040000
+	CONTAINER_COMPANY     ObjectClass = 0x00040001
+	CONTAINER_ADDRESSLIST ObjectClass = 0x00040002
+)
+
+// ObjectClassNameMap maps Kopano object classes to their names.
+var ObjectClassNameMap = map[ObjectClass]string{
+	OBJECTCLASS_UNKNOWN:   "OBJECTCLASS_UNKNOWN",
+	OBJECTCLASS_USER:      "OBJECTCLASS_USER",
+	ACTIVE_USER:           "ACTIVE_USER",
+	NONACTIVE_USER:        "NONACTIVE_USER",
+	NONACTIVE_ROOM:        "NONACTIVE_ROOM",
+	NONACTIVE_EQUIPMENT:   "NONACTIVE_EQUIPMENT",
+	NONACTIVE_CONTACT:     "NONACTIVE_CONTACT",
+	OBJECTCLASS_DISTLIST:  "OBJECTCLASS_DISTLIST",
+	DISTLIST_GROUP:        "DISTLIST_GROUP",
+	DISTLIST_SECURITY:     "DISTLIST_SECURITY",
+	DISTLIST_DYNAMIC:      "DISTLIST_DYNAMIC",
+	OBJECTCLASS_CONTAINER: "OBJECTCLASS_CONTAINER",
+	CONTAINER_COMPANY:     "CONTAINER_COMPANY",
+	CONTAINER_ADDRESSLIST: "CONTAINER_ADDRESSLIST",
+}
+
+func (oc ObjectClass) String() string {
+	if name, ok := ObjectClassNameMap[oc]; ok {
+		return name
+	}
+	return "0x" + strconv.FormatUint(uint64(oc), 16)
+}
+
+// Type returns the object type part of the associated ObjectClass, that is
+// the class with the lower 16 bits cleared.
+func (oc ObjectClass) Type() ObjectClass {
+	return oc &^ 0xffff
+}
+
+// An ExternID is the external object ID as used by the Kopano user plugins
+// together with its object class. For the LDAP plugin, ID holds the value of
+// the configured unique attribute, for the DB and Unix plugins it holds the
+// numeric object ID as string.
+type ExternID struct {
+	Class ObjectClass
+	ID    []byte
+}
+
+// NewExternIDFromABEID returns the ExternID of the provided ABEID. Kopano
+// stores the base64 encoded external ID in the exID of V1 ABEIDs, which is
+// returned decoded by ABEID.ExID. The object class is derived from the ABEID
+// Type, thus only its object type part is known.
+func NewExternIDFromABEID(abeid ABEID) (*ExternID, error) {
+	exID := abeid.ExID()
+	if len(exID) == 0 {
+		return nil, fmt.Errorf("ABEID has no exID")
+	}
+
+	externID := &ExternID{
+		ID: exID,
+	}
+	switch abeid.Type() {
+	case MAPI_MAILUSER:
+		externID.Class = OBJECTCLASS_USER
+	case MAPI_DISTLIST:
+		externID.Class = OBJECTCLASS_DISTLIST
+	case MAPI_ABCONT:
+		externID.Class = OBJECTCLASS_CONTAINER
+	default:
+		externID.Class = OBJECTCLASS_UNKNOWN
+	}
+
+	return externID, nil
+}
+
+func (eid *ExternID) String() string {
+	return string(eid.ID)
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewExternIDFromABEID(t *testing.T) {
+	abeids := []ABEID{}
+	// ABEIDs of users as returned by the server.
+	for _, value := range [][]byte{
+		[]byte("00000000ac21a95040d3ee48b319fba7533044250100000006000000040000004d673d3d00000000"),
+		[]byte("00000000AC21A95040D3EE48B319FBA7533044250100000006000000450000004F4441774D673D3D00000000"),
+	} {
+		abeid, err := NewABEIDFromHex(value)
+		if err != nil {
+			t.Fatalf("invalid ABEID value in test: %v", err)
+		}
+		abeids = append(abeids, abeid)
+	}
+	distlist, _ := NewABEIDV1(MUIDECSAB, MAPI_DISTLIST, 5, []byte{0x01, 0x02, 0x03, 0x04, 0x93, 0x7f})
+	abeids = append(abeids, distlist)
+
+	classes := []ObjectClass{
+		OBJECTCLASS_USER,
+		OBJECTCLASS_USER,
+		OBJECTCLASS_DISTLIST,
+	}
+	ids := [][]byte{
+		[]byte("2"),
+		[]byte("8002"),
+		{0x01, 0x02, 0x03, 0x04, 0x93, 0x7f},
+	}
+
+	for idx, abeid := range abeids {
+		externID, err := NewExternIDFromABEID(abeid)
+		if err != nil {
+			t.Errorf("ExternID(%d) %v", idx, err)
+			continue
+		}
+		if externID.Class != classes[idx] {
+			t.Errorf("ExternID(%d) unexpected class: %v", idx, externID.Class)
+		}
+		if !bytes.Equal(externID.ID, ids[idx]) {
+			t.Errorf("ExternID(%d) unexpected ID: %v", idx, externID.ID)
+		}
+	}
+
+	abeid, _ := NewABEIDV1(MUIDECSAB, MAPI_MAILUSER, 1, nil)
+	if _, err := NewExternIDFromABEID(abeid); err == nil {
+		t.Errorf("expected error for ABEID without exID")
+	}
+}
@@ -0,0 +1,456 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultFailoverHealthCheckInterval is the default minimum duration
+	// between health checks of an unhealthy failover endpoint.
+	DefaultFailoverHealthCheckInterval = 10 * time.Second
+	// DefaultFailoverHealthCheckTimeout is the default timeout of a single
+	// failover endpoint health check.
+	DefaultFailoverHealthCheckTimeout = 5 * time.Second
+	// DefaultFailoverSessionTimeout is the default duration after which an
+	// unused session is forgotten by a failover client.
+	DefaultFailoverSessionTimeout = 30 * time.Minute
+)
+
+// ErrNoFailoverEndpoint is the error returned by a FailoverSOAPClient when no
+// endpoint can be used for a request, for example because the session used by
+// the request was not created through the FailoverSOAPClient.
+var ErrNoFailoverEndpoint = errors.New("no failover endpoint available")
+
+// A FailoverHealthCheck checks the provided client of a failover endpoint and
+// returns an error if the endpoint cannot be used.
+type FailoverHealthCheck func(ctx context.Context, client SOAPClient) error
+
+// A FailoverEndpointStatus holds the state of an endpoint of a
+// FailoverSOAPClient.
+type FailoverEndpointStatus struct {
+	URI        string
+	Healthy    bool
+	ServerGUID string
+	LastError  error
+	Checked    time.Time
+}
+
+type failoverEndpoint struct {
+	uri    string
+	client SOAPClient
+
+	mutex      sync.RWMutex
+	healthy    bool
+	serverGUID string
+	lastErr    error
+	checked    time.Time
+	checking   bool
+}
+
+func (ep *failoverEndpoint) isHealthy() bool {
+	ep.mutex.RLock()
+	defer ep.mutex.RUnlock()
+	return ep.healthy
+}
+
+func (ep *failoverEndpoint) getServerGUID() string {
+	ep.mutex.RLock()
+	defer ep.mutex.RUnlock()
+	return ep.serverGUID
+}
+
+func (ep *failoverEndpoint) setServerGUID(serverGUID string) {
+	ep.mutex.Lock()
+	ep.serverGUID = serverGUID
+	ep.mutex.Unlock()
+}
+
+func (ep *failoverEndpoint) markHealthy() {
+	ep.mutex.Lock()
+	ep.healthy = true
+	ep.lastErr = nil
+	ep.mutex.Unlock()
+}
+
+func (ep *failoverEndpoint) markUnhealthy(err error) {
+	ep.mutex.Lock()
+	ep.healthy = false
+	ep.lastErr = err
+	ep.checked = time.Now()
+	ep.mutex.Unlock()
+}
+
+// A failoverSession is a session created through a FailoverSOAPClient.
+type failoverSession struct {
+	serverGUID string
+	endpoint   *failoverEndpoint
+	used       time.Time
+}
+
+// A FailoverSOAPClient sends requests to the first healthy endpoint of an
+// ordered list of endpoints. Requests which fail because no connection to the
+// endpoint could be established, or which are answered with
+// KCERR_NETWORK_ERROR or KCERR_SERVER_NOT_RESPONDING, mark the endpoint
+// unhealthy and are sent to the next endpoint. All other errors are returned
+// as is, since the request might have reached the server already. Unhealthy
+// endpoints are health checked in the background when used again, so
+// requests fail back to the primary endpoint once it recovers.
+//
+// The server GUID of an endpoint is learned from the logon responses received
+// through it. Requests using a session are only sent to the endpoint which
+// created the session and to endpoints which reported the same server GUID.
+// Requests using a session which was not created through the client fail with
+// ErrNoFailoverEndpoint.
+//
+// FailoverSOAPClient does not implement SOAPStreamClient, since the session
+// of a request is only known from its complete payload. NewSOAPStreamClient
+// reads streamed payloads into memory for it.
+type FailoverSOAPClient struct {
+	// HealthCheck checks unhealthy endpoints. If nil, a check which only
+	// verifies that the endpoint responds to SOAP requests is used.
+	HealthCheck         FailoverHealthCheck
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+
+	// SessionTimeout is the duration after which sessions which were not
+	// used are forgotten. It should be longer than the session timeout of
+	// the server. If zero, sessions are only forgotten when they end.
+	SessionTimeout time.Duration
+
+	endpoints []*failoverEndpoint
+
+	mutex    sync.Mutex
+	sessions map[KCSessionID]*failoverSession
+	pruned   time.Time
+}
+
+// NewFailoverSOAPClient creates a new FailoverSOAPClient for the provided
+// ordered list of URLs, using the provided config to create the SOAP client
+// of each endpoint. All endpoints are considered healthy initially.
+func NewFailoverSOAPClient(uris []*url.URL, config *SOAPClientConfig) (*FailoverSOAPClient, error) {
+	if len(uris) == 0 {
+		return nil, fmt.Errorf("failover client requires at least one URI")
+	}
+
+	endpoints := make([]*failoverEndpoint, 0, len(uris))
+	for _, uri := range uris {
+		client, err := NewSOAPClientWithConfig(uri, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create failover client for %v: %w", uri, err)
+		}
+		endpoints = append(endpoints, &failoverEndpoint{
+			uri:     uri.String(),
+			client:  client,
+			healthy: true,
+		})
+	}
+
+	return newFailoverSOAPClient(endpoints), nil
+}
+
+func newFailoverSOAPClient(endpoints []*failoverEndpoint) *FailoverSOAPClient {
+	return &FailoverSOAPClient{
+		HealthCheckInterval: DefaultFailoverHealthCheckInterval,
+		HealthCheckTimeout:  DefaultFailoverHealthCheckTimeout,
+		SessionTimeout:      DefaultFailoverSessionTimeout,
+
+		endpoints: endpoints,
+		sessions:  make(map[KCSessionID]*failoverSession),
+		pruned:    time.Now(),
+	}
+}
+
+// DoRequest sends the provided payload data as SOAP through the means of the
+// first usable endpoint of the accociated client, failing over to the next
+// endpoint on failure. When all endpoints failed, the last result is
+// returned.
+func (fc *FailoverSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	fc.checkUnhealthy()
+
+	var endpoints []*failoverEndpoint
+	sessionID := soapSessionID(payload)
+	if sessionID == KCNoSessionID {
+		endpoints = fc.candidates(nil)
+	} else {
+		session, ok := fc.session(sessionID)
+		if !ok {
+			return fmt.Errorf("%w for unknown session %v", ErrNoFailoverEndpoint, sessionID)
+		}
+		endpoints = fc.candidates(session)
+	}
+
+	var err error
+	for idx, ep := range endpoints {
+		if idx > 0 {
+			resetResponse(v)
+		}
+
+		err = ep.client.DoRequest(ctx, payload, v)
+		if ctx.Err() != nil {
+			return err
+		}
+
+		var failed error
+		switch {
+		case err == nil:
+			if er := responseKCError(v); isFailoverKCError(er) {
+				failed = er
+			}
+		case isDialError(err):
+			failed = err
+		default:
+			// The request might have reached the server, so it must not
+			// be sent again.
+			return err
+		}
+		if failed == nil {
+			ep.markHealthy()
+			fc.learn(ep, payload, sessionID, v)
+			return nil
+		}
+		ep.markUnhealthy(failed)
+		if isResponseDelivered(v) {
+			// Streamed data must not be delivered twice.
+			return err
+		}
+	}
+
+	return err
+}
+
+// CheckHealth runs the health check for all endpoints of the accociated
+// client and returns ErrNoFailoverEndpoint if none of them is healthy.
+func (fc *FailoverSOAPClient) CheckHealth(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, ep := range fc.endpoints {
+		wg.Add(1)
+		go func(ep *failoverEndpoint) {
+			defer wg.Done()
+			fc.check(ctx, ep)
+		}(ep)
+	}
+	wg.Wait()
+
+	for _, ep := range fc.endpoints {
+		if ep.isHealthy() {
+			return nil
+		}
+	}
+	return ErrNoFailoverEndpoint
+}
+
+// Status returns the status of all endpoints of the accociated client in
+// order.
+func (fc *FailoverSOAPClient) Status() []FailoverEndpointStatus {
+	status := make([]FailoverEndpointStatus, 0, len(fc.endpoints))
+	for _, ep := range fc.endpoints {
+		ep.mutex.RLock()
+		status = append(status, FailoverEndpointStatus{
+			URI:        ep.uri,
+			Healthy:    ep.healthy,
+			ServerGUID: ep.serverGUID,
+			LastError:  ep.lastErr,
+			Checked:    ep.checked,
+		})
+		ep.mutex.RUnlock()
+	}
+	return status
+}
+
+// SetLogger sets the Logger of the clients of all endpoints of the accociated
+// client, if supported.
+func (fc *FailoverSOAPClient) SetLogger(logger Logger) {
+	for _, ep := range fc.endpoints {
+		if setter, ok := ep.client.(loggerSetter); ok {
+			setter.SetLogger(logger)
+		}
+	}
+}
+
+func (fc *FailoverSOAPClient) String() string {
+	clients := make([]string, 0, len(fc.endpoints))
+	for _, ep := range fc.endpoints {
+		clients = append(clients, fmt.Sprint(ep.client))
+	}
+	return fmt.Sprintf("<failover:%s>", strings.Join(clients, ","))
+}
+
+// candidates returns the endpoints which can be used for a request with the
+// provided session, healthy endpoints first. A nil session allows all
+// endpoints.
+func (fc *FailoverSOAPClient) candidates(session *failoverSession) []*failoverEndpoint {
+	healthy := make([]*failoverEndpoint, 0, len(fc.endpoints))
+	var unhealthy []*failoverEndpoint
+	for _, ep := range fc.endpoints {
+		if session != nil && ep != session.endpoint && (session.serverGUID == "" || ep.getServerGUID() != session.serverGUID) {
+			continue
+		}
+		if ep.isHealthy() {
+			healthy = append(healthy, ep)
+		} else {
+			unhealthy = append(unhealthy, ep)
+		}
+	}
+
+	return append(healthy, unhealthy...)
+}
+
+// learn records the server GUID of the provided endpoint and the session of
+// the provided successful request and response.
+func (fc *FailoverSOAPClient) learn(ep *failoverEndpoint, payload *string, sessionID KCSessionID, v interface{}) {
+	if resp, ok := v.(*LogonResponse); ok {
+		if (resp.Er == KCSuccess || resp.Er == KCERR_SSO_CONTINUE) && resp.SessionID != KCNoSessionID {
+			if resp.ServerGUID != "" {
+				ep.setServerGUID(resp.ServerGUID)
+			}
+			now := time.Now()
+			fc.mutex.Lock()
+			fc.sessions[resp.SessionID] = &failoverSession{
+				serverGUID: resp.ServerGUID,
+				endpoint:   ep,
+				used:       now,
+			}
+			fc.prune(now)
+			fc.mutex.Unlock()
+		}
+		return
+	}
+	if sessionID == KCNoSessionID {
+		return
+	}
+
+	if soapMethodName(payload) == "logoff" || responseKCError(v) == KCERR_END_OF_SESSION {
+		fc.mutex.Lock()
+		delete(fc.sessions, sessionID)
+		fc.mutex.Unlock()
+	}
+}
+
+// session returns the provided session and marks it as used. If the session
+// is unknown or expired, false is returned.
+func (fc *FailoverSOAPClient) session(sessionID KCSessionID) (*failoverSession, bool) {
+	now := time.Now()
+
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	session, ok := fc.sessions[sessionID]
+	if !ok {
+		return nil, false
+	}
+	if fc.SessionTimeout > 0 && now.Sub(session.used) >= fc.SessionTimeout {
+		delete(fc.sessions, sessionID)
+		return nil, false
+	}
+	session.used = now
+	return session, true
+}
+
+// prune removes all sessions which were not used within the session timeout,
+// at most once per session timeout. The caller must hold the mutex.
+func (fc *FailoverSOAPClient) prune(now time.Time) {
+	if fc.SessionTimeout <= 0 || now.Sub(fc.pruned) < fc.SessionTimeout {
+		return
+	}
+	fc.pruned = now
+
+	for sessionID, session := range fc.sessions {
+		if now.Sub(session.used) >= fc.SessionTimeout {
+			delete(fc.sessions, sessionID)
+		}
+	}
+}
+
+// checkUnhealthy starts background health checks for all unhealthy endpoints
+// which were not checked within the health check interval.
+func (fc *FailoverSOAPClient) checkUnhealthy() {
+	for _, ep := range fc.endpoints {
+		ep.mutex.Lock()
+		due := !ep.healthy && !ep.checking && time.Since(ep.checked) >= fc.HealthCheckInterval
+		if due {
+			ep.checking = true
+		}
+		ep.mutex.Unlock()
+
+		if due {
+			go func(ep *failoverEndpoint) {
+				fc.check(context.Background(), ep)
+				ep.mutex.Lock()
+				ep.checking = false
+				ep.mutex.Unlock()
+			}(ep)
+		}
+	}
+}
+
+// check runs the health check for the provided endpoint and updates its
+// state accordingly.
+func (fc *FailoverSOAPClient) check(ctx context.Context, ep *failoverEndpoint) {
+	if fc.HealthCheckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fc.HealthCheckTimeout)
+		defer cancel()
+	}
+
+	healthCheck := fc.HealthCheck
+	if healthCheck == nil {
+		healthCheck = defaultFailoverHealthCheck
+	}
+
+	err := healthCheck(ctx, ep.client)
+
+	ep.mutex.Lock()
+	ep.healthy = err == nil
+	ep.lastErr = err
+	ep.checked = time.Now()
+	ep.mutex.Unlock()
+}
+
+// defaultFailoverHealthCheck sends a logoff request without session, which
+// any reachable server answers without side effects.
+func defaultFailoverHealthCheck(ctx context.Context, client SOAPClient) error {
+	payload := "<ns:logoff><ulSessionId>" +
+		KCNoSessionID.String() +
+		"</ulSessionId></ns:logoff>"
+
+	var logoffResponse LogoffResponse
+	if err := client.DoRequest(ctx, &payload, &logoffResponse); err != nil {
+		return err
+	}
+	if isFailoverKCError(logoffResponse.Er) {
+		return logoffResponse.Er
+	}
+
+	return nil
+}
+
+// isFailoverKCError returns true for KCErrors which signal that the server
+// cannot be reached through the endpoint which returned it.
+func isFailoverKCError(er KCError) bool {
+	return er == KCERR_NETWORK_ERROR || er == KCERR_SERVER_NOT_RESPONDING
+}
@@ -0,0 +1,334 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// errTestDial is the error of a failover endpoint which cannot be reached.
+var errTestDial = &net.OpError{
+	Op:  "dial",
+	Net: "unix",
+	Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+}
+
+// testFailoverEndpoint returns a failover endpoint which responds to logon
+// with the provided server GUID and fails to connect while down is set.
+func testFailoverEndpoint(name, serverGUID string, sessionID KCSessionID, down *int32, requests *int32) *failoverEndpoint {
+	return &failoverEndpoint{
+		uri: name,
+		client: testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+			atomic.AddInt32(requests, 1)
+			if atomic.LoadInt32(down) != 0 {
+				return errTestDial
+			}
+			switch response := v.(type) {
+			case *LogonResponse:
+				response.SessionID = sessionID
+				response.ServerGUID = serverGUID
+			case *LogoffResponse:
+				response.Er = KCERR_END_OF_SESSION
+			}
+			return nil
+		}),
+		healthy: true,
+	}
+}
+
+func TestFailoverSOAPClientFailoverAndFailback(t *testing.T) {
+	var primaryDown, primaryRequests, backupRequests int32
+	client := newFailoverSOAPClient([]*failoverEndpoint{
+		testFailoverEndpoint("primary", "guid-a", 1, &primaryDown, &primaryRequests),
+		testFailoverEndpoint("backup", "guid-b", 2, new(int32), &backupRequests),
+	})
+	c := NewKCCWithClient(client)
+
+	atomic.StoreInt32(&primaryDown, 1)
+	if _, err := c.ResolveUsername(context.Background(), "user1", KCNoSessionID); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&primaryRequests) != 1 || atomic.LoadInt32(&backupRequests) != 1 {
+		t.Errorf("request did not fail over: primary %d, backup %d", primaryRequests, backupRequests)
+	}
+	if status := client.Status(); status[0].Healthy || !errors.Is(status[0].LastError, syscall.ECONNREFUSED) {
+		t.Errorf("primary was not marked unhealthy: %+v", status[0])
+	}
+
+	// Unhealthy primary is not used until its health check succeeded.
+	if _, err := c.ResolveUsername(context.Background(), "user1", KCNoSessionID); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&backupRequests) != 2 {
+		t.Errorf("request was not sent to healthy backup")
+	}
+
+	atomic.StoreInt32(&primaryDown, 0)
+	if err := client.CheckHealth(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&primaryRequests, 0)
+	atomic.StoreInt32(&backupRequests, 0)
+	if _, err := c.ResolveUsername(context.Background(), "user1", KCNoSessionID); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&primaryRequests) != 1 || atomic.LoadInt32(&backupRequests) != 0 {
+		t.Errorf("request did not fail back: primary %d, backup %d", primaryRequests, backupRequests)
+	}
+}
+
+func TestFailoverSOAPClientKCError(t *testing.T) {
+	var backupRequests int32
+	client := newFailoverSOAPClient([]*failoverEndpoint{
+		{
+			uri: "primary",
+			client: testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+				v.(*ResolveUserResponse).Er = KCERR_SERVER_NOT_RESPONDING
+				return nil
+			}),
+			healthy: true,
+		},
+		testFailoverEndpoint("backup", "guid-b", 2, new(int32), &backupRequests),
+	})
+
+	resp, err := NewKCCWithClient(client).ResolveUsername(context.Background(), "user1", KCNoSessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Er != KCSuccess || backupRequests != 1 {
+		t.Errorf("request did not fail over on KCError: %+v", resp)
+	}
+}
+
+func TestFailoverSOAPClientSessionServerGUID(t *testing.T) {
+	var primaryDown, primaryRequests, otherRequests, sameRequests int32
+	client := newFailoverSOAPClient([]*failoverEndpoint{
+		testFailoverEndpoint("primary", "guid-a", 1, &primaryDown, &primaryRequests),
+		testFailoverEndpoint("other", "guid-b", 2, new(int32), &otherRequests),
+		testFailoverEndpoint("same", "guid-a", 1, new(int32), &sameRequests),
+	})
+	client.endpoints[1].serverGUID = "guid-b"
+	client.endpoints[2].serverGUID = "guid-a"
+	c := NewKCCWithClient(client)
+
+	logon, err := c.Logon(context.Background(), "user1", "pass", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logon.ServerGUID != "guid-a" || client.Status()[0].ServerGUID != "guid-a" {
+		t.Fatalf("server GUID was not learned from logon: %+v", client.Status()[0])
+	}
+
+	atomic.StoreInt32(&primaryDown, 1)
+	if _, err = c.ResolveUsername(context.Background(), "user1", logon.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	if otherRequests != 0 || sameRequests != 1 {
+		t.Errorf("session request was not sent to endpoint with same server GUID: other %d, same %d", otherRequests, sameRequests)
+	}
+
+	// Without other endpoint reporting the session server GUID, only the
+	// failed primary is tried.
+	client.endpoints[2].setServerGUID("guid-c")
+	if _, err = c.ResolveUsername(context.Background(), "user1", logon.SessionID); err != errTestDial {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if otherRequests != 0 || sameRequests != 1 {
+		t.Errorf("session request was sent to endpoint with other server GUID")
+	}
+}
+
+func TestFailoverSOAPClientSessionEndpoint(t *testing.T) {
+	var primaryDown, primaryRequests, backupRequests int32
+	client := newFailoverSOAPClient([]*failoverEndpoint{
+		testFailoverEndpoint("primary", "", 1, &primaryDown, &primaryRequests),
+		testFailoverEndpoint("backup", "", 2, new(int32), &backupRequests),
+	})
+	c := NewKCCWithClient(client)
+
+	if _, err := c.ResolveUsername(context.Background(), "user1", 3); !errors.Is(err, ErrNoFailoverEndpoint) {
+		t.Errorf("expected no failover endpoint error for unknown session, got %v", err)
+	}
+	if primaryRequests != 0 || backupRequests != 0 {
+		t.Errorf("request with unknown session was sent")
+	}
+
+	logon, err := c.Logon(context.Background(), "user1", "pass", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&primaryDown, 1)
+	if _, err = c.ResolveUsername(context.Background(), "user1", logon.SessionID); err != errTestDial {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if primaryRequests != 2 || backupRequests != 0 {
+		t.Errorf("session without server GUID was not pinned to its endpoint: primary %d, backup %d", primaryRequests, backupRequests)
+	}
+}
+
+func TestFailoverSOAPClientRequestError(t *testing.T) {
+	for _, requestErr := range []error{
+		io.ErrUnexpectedEOF,
+		&SOAPFault{Code: "SOAP-ENV:Server", String: "failed"},
+		&HTTPStatusError{StatusCode: 502},
+	} {
+		var backupRequests int32
+		client := newFailoverSOAPClient([]*failoverEndpoint{
+			{
+				uri: "primary",
+				client: testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+					return requestErr
+				}),
+				healthy: true,
+			},
+			testFailoverEndpoint("backup", "guid-b", 2, new(int32), &backupRequests),
+		})
+
+		_, err := NewKCCWithClient(client).Logon(context.Background(), "user1", "pass", 0)
+		if err != requestErr {
+			t.Errorf("unexpected error for %v: %v", requestErr, err)
+		}
+		if backupRequests != 0 || !client.Status()[0].Healthy {
+			t.Errorf("request failed over on error which does not prove that the server was not reached: %v", requestErr)
+		}
+	}
+}
+
+func TestFailoverSOAPClientDefaultHealthCheck(t *testing.T) {
+	var down int32
+	var er KCError
+	var payloads []string
+	client := newFailoverSOAPClient([]*failoverEndpoint{{
+		uri: "primary",
+		client: testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+			payloads = append(payloads, *payload)
+			if atomic.LoadInt32(&down) != 0 {
+				return errTestDial
+			}
+			v.(*LogoffResponse).Er = er
+			return nil
+		}),
+	}})
+
+	er = KCERR_END_OF_SESSION
+	if err := client.CheckHealth(context.Background()); err != nil {
+		t.Errorf("unexpected health check error: %v", err)
+	}
+	if len(payloads) != 1 || !strings.Contains(payloads[0], "<ns:logoff><ulSessionId>0</ulSessionId></ns:logoff>") {
+		t.Errorf("unexpected health check request: %v", payloads)
+	}
+	if status := client.Status()[0]; !status.Healthy || status.Checked.IsZero() {
+		t.Errorf("endpoint was not marked healthy: %+v", status)
+	}
+
+	er = KCERR_SERVER_NOT_RESPONDING
+	if err := client.CheckHealth(context.Background()); !errors.Is(err, ErrNoFailoverEndpoint) {
+		t.Errorf("expected no failover endpoint error, got %v", err)
+	}
+	if status := client.Status()[0]; status.Healthy || status.LastError != KCERR_SERVER_NOT_RESPONDING {
+		t.Errorf("endpoint was not marked unhealthy on KCError: %+v", status)
+	}
+
+	atomic.StoreInt32(&down, 1)
+	if err := client.CheckHealth(context.Background()); !errors.Is(err, ErrNoFailoverEndpoint) {
+		t.Errorf("expected no failover endpoint error, got %v", err)
+	}
+	if status := client.Status()[0]; status.Healthy || status.LastError != errTestDial {
+		t.Errorf("endpoint was not marked unhealthy on dial error: %+v", status)
+	}
+}
+
+func TestFailoverSOAPClientSessionTimeout(t *testing.T) {
+	client := newFailoverSOAPClient([]*failoverEndpoint{
+		testFailoverEndpoint("primary", "guid-a", 1, new(int32), new(int32)),
+	})
+	client.SessionTimeout = time.Hour
+	expired := time.Now().Add(-2 * time.Hour)
+	client.sessions[5] = &failoverSession{endpoint: client.endpoints[0], used: expired}
+	client.pruned = expired
+	c := NewKCCWithClient(client)
+
+	if _, err := c.Logon(context.Background(), "user1", "pass", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.sessions[5]; ok || len(client.sessions) != 1 {
+		t.Errorf("expired session was not pruned: %d sessions", len(client.sessions))
+	}
+
+	client.sessions[1].used = expired
+	if _, err := c.ResolveUsername(context.Background(), "user1", 1); !errors.Is(err, ErrNoFailoverEndpoint) {
+		t.Errorf("expected no failover endpoint error for expired session, got %v", err)
+	}
+}
+
+func TestNewFailoverSOAPClient(t *testing.T) {
+	primary, _ := url.Parse("file:///run/kopano/server.sock")
+	backup, _ := url.Parse("https://kopano.example.com:237/")
+	client, err := NewFailoverSOAPClient([]*url.URL{primary, backup}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := client.Status(); len(status) != 2 || !status[0].Healthy || status[1].URI != backup.String() {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	if _, err = NewFailoverSOAPClient(nil, nil); err == nil {
+		t.Errorf("expected error without URIs")
+	}
+}
+
+func TestFailoverSOAPClientDeliveredStream(t *testing.T) {
+	var backupRequests int32
+	client := newFailoverSOAPClient([]*failoverEndpoint{
+		{
+			uri: "primary",
+			client: testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+				response := v.(*ABResolveNamesStreamResponse)
+				response.RowSet.Count++
+				if err := response.RowSet.Handler(&PropTagRowSet{}); err != nil {
+					return err
+				}
+				return io.ErrUnexpectedEOF
+			}),
+			healthy: true,
+		},
+		testFailoverEndpoint("backup", "guid-b", 2, new(int32), &backupRequests),
+	})
+	c := NewKCCWithClient(client)
+
+	handled := 0
+	_, err := c.ABResolveNamesStream(context.Background(), []PT{PR_ACCOUNT_A}, map[PT]interface{}{PR_ACCOUNT_A: "user"}, 0, KCNoSessionID, 0, func(row *PropTagRowSet) error {
+		handled++
+		return nil
+	})
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if handled != 1 || atomic.LoadInt32(&backupRequests) != 0 {
+		t.Errorf("delivered stream failed over: %d rows handled, %d backup requests", handled, backupRequests)
+	}
+}
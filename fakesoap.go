@@ -17,20 +17,24 @@
 package kcc
 
 import (
-	"bufio"
-	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
-
-	"github.com/eternnoir/gncp"
+	"unicode/utf8"
 )
 
 const (
@@ -40,69 +44,155 @@ const (
 	soapFooter = `</SOAP-ENV:Body></SOAP-ENV:Envelope>`
 )
 
-func soapEnvelope(payload *string) *bytes.Buffer {
-	var b bytes.Buffer
-	b.WriteString(soapHeader)
-	b.WriteString(*payload)
-	b.WriteString(soapFooter)
+var (
+	soapContentTypeHeader = []string{"text/xml; charset=utf-8"}
+	soapUserAgentHeader   = []string{soapUserAgent + "/" + Version}
+)
+
+// An envelopeReader reads the SOAP envelope of a payload without copying the
+// payload into a buffer first.
+type envelopeReader struct {
+	payload *string
+	offset  int
+}
 
-	if debug {
-		raw, _ := ioutil.ReadAll(&b)
-		b = *bytes.NewBuffer(raw)
-		fmt.Printf("SOAP --- request start ---\n%s\nSOAP --- request end  ---\n", string(raw))
+func newEnvelopeReader(payload *string) *envelopeReader {
+	return &envelopeReader{
+		payload: payload,
 	}
-	return &b
 }
 
-func newSOAPRequest(ctx context.Context, url string, payload *string) (*http.Request, error) {
-	body := soapEnvelope(payload)
+// Len returns the number of unread bytes of the accociated envelope.
+func (r *envelopeReader) Len() int {
+	return len(soapHeader) + len(*r.payload) + len(soapFooter) - r.offset
+}
 
-	req, err := http.NewRequest(http.MethodPost, url, body)
-	if err != nil {
-		return nil, err
-	}
-	if ctx != nil {
-		req = req.WithContext(ctx)
+func (r *envelopeReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		var part string
+		switch offset := r.offset; {
+		case offset < len(soapHeader):
+			part = soapHeader[offset:]
+		case offset < len(soapHeader)+len(*r.payload):
+			part = (*r.payload)[offset-len(soapHeader):]
+		case offset < len(soapHeader)+len(*r.payload)+len(soapFooter):
+			part = soapFooter[offset-len(soapHeader)-len(*r.payload):]
+		default:
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, nil
+		}
+		copied := copy(p[n:], part)
+		n += copied
+		r.offset += copied
 	}
+	return n, nil
+}
 
-	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	req.Header.Set("User-Agent", soapUserAgent+"/"+Version)
+// WriteTo implements the io.WriterTo interface, writing the unread part of
+// the accociated envelope to the provided writer.
+func (r *envelopeReader) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for r.Len() > 0 {
+		var part string
+		switch offset := r.offset; {
+		case offset < len(soapHeader):
+			part = soapHeader[offset:]
+		case offset < len(soapHeader)+len(*r.payload):
+			part = (*r.payload)[offset-len(soapHeader):]
+		default:
+			part = soapFooter[offset-len(soapHeader)-len(*r.payload):]
+		}
+		n, err := io.WriteString(w, part)
+		written += int64(n)
+		r.offset += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
 
-	return req, nil
+func (r *envelopeReader) Close() error {
+	return nil
 }
 
-func debugRawResponse(code int, data io.Reader) (io.Reader, error) {
-	raw, err := ioutil.ReadAll(data)
+// newSOAPRequest creates a HTTP request for the provided payload. The SOAP
+// envelope is compressed according to the provided compression settings and
+// the HTTP headers found in the provided context are added.
+func newSOAPRequest(ctx context.Context, url string, payload *string, compression *SOAPCompression) (*http.Request, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	envelope := newEnvelopeReader(payload)
+	size := envelope.Len()
+	compressed := compression.compressRequest(size)
+
+	var body io.Reader = envelope
+	if compressed {
+		var err error
+		body, err = compression.encodeRequest(envelope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
 	if err != nil {
 		return nil, err
 	}
+	if !compressed {
+		req.ContentLength = int64(size)
+		req.GetBody = func() (io.ReadCloser, error) {
+			return newEnvelopeReader(payload), nil
+		}
+	}
 
-	fmt.Printf("SOAP --- response %d start ---\n%s\nSOAP --- response end  ---\n", code, string(raw))
+	setSOAPRequestHeaders(ctx, req, compression, compressed)
 
-	return bytes.NewBuffer(raw), nil
+	return req, nil
 }
 
-func parseSOAPResponse(code int, data io.Reader, v interface{}) error {
-	if debug {
-		var err error
-		data, err = debugRawResponse(code, data)
-		if err != nil {
-			return err
+// setSOAPRequestHeaders sets the HTTP headers of the provided request and adds
+// the HTTP headers found in the provided context.
+func setSOAPRequestHeaders(ctx context.Context, req *http.Request, compression *SOAPCompression, compressed bool) {
+	req.Header["Content-Type"] = soapContentTypeHeader
+	req.Header["User-Agent"] = soapUserAgentHeader
+	compression.setRequestHeaders(req.Header, compressed)
+	if header, ok := HTTPHeaderFromContext(ctx); ok {
+		for key, values := range header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
 		}
 	}
+}
 
-	decoder := xml.NewDecoder(data)
+func parseSOAPResponse(code int, data io.Reader, v interface{}, limits responseLimits) error {
+	decoder := limits.decoder(data)
 
 	match := false
 	for {
-		t, _ := decoder.Token()
+		t, err := decoder.Token()
 		if t == nil {
+			if err != nil && err != io.EOF {
+				return fmt.Errorf("failed to unmarshal SOAP response body: %w", err)
+			}
 			break
 		}
 
 		switch se := t.(type) {
 		case xml.StartElement:
 			if match {
+				if se.Name.Local == "Fault" {
+					return decodeSOAPFault(code, decoder, &se)
+				}
+				if v == nil {
+					return fmt.Errorf("no SOAP fault in response body")
+				}
 				return decoder.DecodeElement(v, &se)
 			}
 
@@ -115,6 +205,124 @@ func parseSOAPResponse(code int, data io.Reader, v interface{}) error {
 	return fmt.Errorf("failed to unmarshal SOAP response body")
 }
 
+// readSOAPResponse decodes the body of the provided response into v. The
+// body is decompressed and the provided limits are applied.
+func readSOAPResponse(ctx context.Context, logger Logger, method string, resp *http.Response, v interface{}, limits responseLimits) error {
+	body, err := decodeResponseBody(resp, countResponse(ctx, resp.Body))
+	if err != nil {
+		return err
+	}
+	data, err := logSOAPResponse(logger, method, resp.StatusCode, limits.reader(body))
+	if err != nil {
+		return err
+	}
+	data, err = captureResponse(ctx, resp.StatusCode, data)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return parseSOAPErrorResponse(resp.StatusCode, data, limits)
+	}
+
+	if decoder, ok := v.(fastDecoder); ok {
+		return parseSOAPResponseFast(resp.StatusCode, data, decoder, limits)
+	}
+	return parseSOAPResponse(resp.StatusCode, data, v, limits)
+}
+
+// soapMethodName returns the name of the SOAP method called by the provided
+// payload, that is the local name of its first element.
+func soapMethodName(payload *string) string {
+	if payload == nil || !strings.HasPrefix(*payload, "<") {
+		return ""
+	}
+	name := *payload
+	if end := strings.IndexAny(name, " />"); end > 0 {
+		name = name[1:end]
+	} else {
+		name = name[1:]
+	}
+	if idx := strings.IndexByte(name, ':'); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return name
+}
+
+// soapSessionID returns the session ID sent with the provided payload, that is
+// the value of its first ulSessionId element.
+func soapSessionID(payload *string) KCSessionID {
+	const startTag, endTag = "<ulSessionId>", "</ulSessionId>"
+	if payload == nil {
+		return KCNoSessionID
+	}
+	start := strings.Index(*payload, startTag)
+	if start < 0 {
+		return KCNoSessionID
+	}
+	value := (*payload)[start+len(startTag):]
+	end := strings.Index(value, endTag)
+	if end < 0 {
+		return KCNoSessionID
+	}
+	id, err := strconv.ParseUint(value[:end], 10, 64)
+	if err != nil {
+		return KCNoSessionID
+	}
+	return KCSessionID(id)
+}
+
+// responseKCError returns the value of the KCError field Er of the provided
+// response struct pointer. If there is no such field, KCSuccess is returned.
+func responseKCError(v interface{}) KCError {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return KCSuccess
+	}
+	field := rv.Elem().FieldByName("Er")
+	if !field.IsValid() || !field.CanInterface() {
+		return KCSuccess
+	}
+	if er, ok := field.Interface().(KCError); ok {
+		return er
+	}
+	return KCSuccess
+}
+
+// A responseResetter is a response which needs to keep some of its values
+// when being reset.
+type responseResetter interface {
+	resetResponse()
+}
+
+// A deliveringResponse is a response which passes decoded data on while it
+// is decoded. Once data was delivered, the request must not be sent again
+// since the data would be delivered twice.
+type deliveringResponse interface {
+	responseDelivered() bool
+}
+
+// isResponseDelivered returns true if the provided response already passed
+// decoded data on, so its request must not be retried.
+func isResponseDelivered(v interface{}) bool {
+	if delivering, ok := v.(deliveringResponse); ok {
+		return delivering.responseDelivered()
+	}
+	return false
+}
+
+// resetResponse sets the provided response struct pointer to its zero value,
+// so it can be used again to decode a response.
+func resetResponse(v interface{}) {
+	if resetter, ok := v.(responseResetter); ok {
+		resetter.resetResponse()
+		return
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+	}
+}
+
 // A SOAPClient is a network client which sends SOAP requests.
 type SOAPClient interface {
 	DoRequest(ctx context.Context, payload *string, v interface{}) error
@@ -125,6 +333,35 @@ type SOAPClient interface {
 type SOAPClientConfig struct {
 	HTTPClient   *http.Client
 	SocketDialer *net.Dialer
+
+	// Proxy is the URL of a proxy for HTTP SOAP requests if set. Supported
+	// are HTTP proxies with the http and https schemes, which use CONNECT for
+	// https server URIs, and SOCKS5 proxies with the socks5 and socks5h
+	// schemes.
+	Proxy *url.URL
+	// TLSClientConfig is used for https server URIs if set.
+	TLSClientConfig *tls.Config
+	// RootCAs replaces the trusted root CAs for https server URIs if set.
+	RootCAs *x509.CertPool
+	// PinnedSPKI lists base64 encoded SHA-256 hashes of the public keys of
+	// trusted certificates, see SPKISHA256. If set, servers are only
+	// accepted if their certificate chain contains one of them.
+	PinnedSPKI []string
+
+	// UnixMaxConnections limits the number of unix socket connections. If
+	// zero, DefaultUnixMaxConnections is used.
+	UnixMaxConnections int
+	// UnixIdleConnTimeout is the duration after which idle unix socket
+	// connections are closed. If zero, DefaultUnixIdleConnTimeout is used.
+	UnixIdleConnTimeout time.Duration
+
+	// MaxResponseSize and MaxResponseDepth limit the responses of the created
+	// clients, see SOAPHTTPClient.
+	MaxResponseSize  int64
+	MaxResponseDepth int
+
+	// Compression is set on the created clients.
+	Compression *SOAPCompression
 }
 
 // DefaultSOAPClientConfig is the default SOAP client config which is used when
@@ -135,58 +372,104 @@ var DefaultSOAPClientConfig = &SOAPClientConfig{}
 type SOAPHTTPClient struct {
 	Client *http.Client
 	URI    string
+
+	// Logger is used to log requests. If nil, the DefaultLogger is used.
+	Logger Logger
+
+	// MaxResponseSize limits the size of responses in bytes and
+	// MaxResponseDepth limits the element nesting depth of responses. If
+	// zero, DefaultMaxResponseSize and DefaultMaxResponseDepth are used. Set
+	// to a negative value to disable the limit.
+	MaxResponseSize  int64
+	MaxResponseDepth int
+
+	// Compression enables gzip compression of requests and responses if set.
+	Compression *SOAPCompression
+}
+
+// A ConnPool provides network connections. Its methods match the connection
+// pools of github.com/eternnoir/gncp, which SOAPSocketClient used before
+// connections were pooled by a http.Transport.
+type ConnPool interface {
+	Get() (net.Conn, error)
+	GetWithTimeout(timeout time.Duration) (net.Conn, error)
+	Close() error
+	Remove(conn net.Conn) error
 }
 
 // A SOAPSocketClient implements a SOAP client connecting to a unix socket.
+// Requests are sent as HTTP requests through a http.Transport which keeps
+// idle connections open for reuse. The time to wait for a response is only
+// limited by the context of the request.
 type SOAPSocketClient struct {
-	Dialer *net.Dialer
-	Pool   gncp.ConnPool
-	Path   string
+	Dialer    *net.Dialer
+	Transport *http.Transport
+	Path      string
+
+	// Pool provides the connections for the accociated Transport if set,
+	// instead of dialing them with Dialer. Connections closed by Transport
+	// are removed from Pool.
+	//
+	// Deprecated: Idle connections are pooled by Transport, use its
+	// settings to limit the number of connections.
+	Pool ConnPool
+
+	// Logger is used to log requests. If nil, the DefaultLogger is used.
+	Logger Logger
+
+	// MaxResponseSize limits the size of responses in bytes and
+	// MaxResponseDepth limits the element nesting depth of responses. If
+	// zero, DefaultMaxResponseSize and DefaultMaxResponseDepth are used. Set
+	// to a negative value to disable the limit.
+	MaxResponseSize  int64
+	MaxResponseDepth int
+
+	// Compression enables gzip compression of requests and responses if set.
+	Compression *SOAPCompression
+
+	// MaxStaleRetries is the number of times a request is retried when it
+	// failed on a reused connection which was closed by the server before
+	// any part of the request was written. Requests which reached the server
+	// are never retried.
+	MaxStaleRetries int
+
+	// OnPoolWait is called with the duration waited for a pooled connection
+	// if set.
+	OnPoolWait func(time.Duration)
+	// OnConnReuse is called for every request with whether an idle
+	// connection was reused if set.
+	OnConnReuse func(reused bool)
+
+	poolSize int32
 }
 
 // NewSOAPClient creates a new SOAP client for the protocol matching the
 // provided URL using default connection settings. If the protocol is
 // unsupported, an error is returned.
 func NewSOAPClient(uri *url.URL) (SOAPClient, error) {
-	if uri == nil {
-		uri, _ = url.Parse(DefaultURI)
-	}
-	switch uri.Scheme {
-	case "https":
-		fallthrough
-	case "http":
-		return NewSOAPHTTPClient(uri, nil)
-
-	case "file":
-		return NewSOAPSocketClient(uri, nil)
-
-	default:
-		return nil, fmt.Errorf("invalid scheme '%v' for SOAP client", uri.Scheme)
-	}
+	return newSOAPClient(uri, &SOAPClientConfig{})
 }
 
 // NewSOAPClientWithConfig create new SOAP client for the protocol matching
 // the provided URL using defaulft uri and config if nil is providedl. If the
-// protocol is unsupported, an error is returned.
+// protocol is unsupported, an error is returned. Additional protocols can be
+// added with RegisterSOAPScheme.
 func NewSOAPClientWithConfig(uri *url.URL, config *SOAPClientConfig) (SOAPClient, error) {
-	if uri == nil {
-		uri, _ = url.Parse(DefaultURI)
-	}
 	if config == nil {
 		config = DefaultSOAPClientConfig
 	}
-	switch uri.Scheme {
-	case "https":
-		fallthrough
-	case "http":
-		return NewSOAPHTTPClient(uri, config.HTTPClient)
-
-	case "file":
-		return NewSOAPSocketClient(uri, config.SocketDialer)
+	return newSOAPClient(uri, config)
+}
 
-	default:
+func newSOAPClient(uri *url.URL, config *SOAPClientConfig) (SOAPClient, error) {
+	if uri == nil {
+		uri, _ = url.Parse(DefaultURI)
+	}
+	factory, ok := LookupSOAPScheme(uri.Scheme)
+	if !ok {
 		return nil, fmt.Errorf("invalid scheme '%v' for SOAP client", uri.Scheme)
 	}
+	return factory(uri, config)
 }
 
 // NewSOAPHTTPClient creates a new SOAP HTTP client for the protocol matching the
@@ -226,6 +509,10 @@ func NewSOAPHTTPClient(uri *url.URL, client *http.Client) (*SOAPHTTPClient, erro
 // the behavior of the client instead of using the defaults. If the protocol is
 //  unsupported, an error is returned.
 func NewSOAPSocketClient(uri *url.URL, dialer *net.Dialer) (*SOAPSocketClient, error) {
+	return newSOAPSocketClient(uri, dialer, 0)
+}
+
+func newSOAPSocketClient(uri *url.URL, dialer *net.Dialer, maxConnections int) (*SOAPSocketClient, error) {
 	var err error
 
 	if uri == nil {
@@ -239,20 +526,29 @@ func NewSOAPSocketClient(uri *url.URL, dialer *net.Dialer) (*SOAPSocketClient, e
 		dialer = DefaultUnixDialer
 	}
 
-	if uri.Scheme != "file" {
-		return nil, fmt.Errorf("invalid scheme '%v' for SOAP socket client", uri.Scheme)
+	path, err := unixSocketPath(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxConnections <= 0 {
+		maxConnections = DefaultUnixMaxConnections
 	}
 
 	c := &SOAPSocketClient{
 		Dialer: dialer,
-		Path:   uri.Path,
-	}
+		Path:   path,
 
-	pool, err := gncp.NewPool(0, DefaultUnixMaxConnections, c.connect)
-	if err != nil {
-		return nil, err
+		MaxStaleRetries: DefaultUnixMaxStaleRetries,
+	}
+	c.Transport = &http.Transport{
+		DialContext:         c.dialContext,
+		MaxIdleConns:        maxConnections,
+		MaxIdleConnsPerHost: maxConnections,
+		MaxConnsPerHost:     maxConnections,
+		IdleConnTimeout:     DefaultUnixIdleConnTimeout,
+		DisableCompression:  true,
 	}
-	c.Pool = pool
 
 	return c, nil
 }
@@ -260,32 +556,38 @@ func NewSOAPSocketClient(uri *url.URL, dialer *net.Dialer) (*SOAPSocketClient, e
 // DoRequest sends the provided payload data as SOAP through the means of the
 // accociated client. Connections are automatically reused according to keep-alive
 // configuration provided by the http.Client attached to the SOAPHTTPClient.
-func (sc *SOAPHTTPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
-	body := soapEnvelope(payload)
+func (sc *SOAPHTTPClient) DoRequest(ctx context.Context, payload *string, v interface{}) (err error) {
+	logger := soapClientLogger(sc.Logger)
+	if logger != nil {
+		logSOAPRequest(logger, payload)
+		defer func(started time.Time) {
+			logSOAPDone(logger, soapMethodName(payload), started, err)
+		}(time.Now())
+	}
 
-	req, err := http.NewRequest(http.MethodPost, sc.URI, body)
+	req, err := newSOAPRequest(ctx, sc.URI, payload, sc.Compression)
 	if err != nil {
 		return err
 	}
-	if ctx != nil {
-		req = req.WithContext(ctx)
-	}
 
-	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	req.Header.Set("User-Agent", soapUserAgent+"/"+Version)
+	return sc.do(ctx, logger, soapMethodName(payload), req, v)
+}
 
+// do sends the provided request and decodes the response into v.
+func (sc *SOAPHTTPClient) do(ctx context.Context, logger Logger, method string, req *http.Request, v interface{}) error {
 	resp, err := sc.Client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		debugRawResponse(resp.StatusCode, resp.Body)
-		return fmt.Errorf("unexpected http response status: %v", resp.StatusCode)
-	}
+	limits := newResponseLimits(sc.MaxResponseSize, sc.MaxResponseDepth)
+	return readSOAPResponse(ctx, logger, method, resp, v, limits)
+}
 
-	return parseSOAPResponse(resp.StatusCode, resp.Body, v)
+// SetLogger sets the Logger of the accociated client.
+func (sc *SOAPHTTPClient) SetLogger(logger Logger) {
+	sc.Logger = logger
 }
 
 func (sc *SOAPHTTPClient) String() string {
@@ -293,63 +595,189 @@ func (sc *SOAPHTTPClient) String() string {
 }
 
 // DoRequest sends the provided payload data as SOAP through the means of the
-// accociated client.
-func (sc *SOAPSocketClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
-	for {
-		// TODO(longsleep): Use a pool which allows to add additional connections
-		// in burst situations. With this current implementation based on Go
-		// channel select, requests can timeout on burst situations where
-		// constantly more requests than pooled connections are available come
-		// in as Go's select is non-deterministic.
-		c, err := sc.Pool.GetWithTimeout(sc.Dialer.Timeout)
-		if err != nil {
-			return fmt.Errorf("failed to open unix socket: %v", err)
-		}
+// accociated client. Waiting for a connection and socket I/O are aborted when
+// the provided context is done, with an error wrapping the context's error.
+func (sc *SOAPSocketClient) DoRequest(ctx context.Context, payload *string, v interface{}) (err error) {
+	logger := soapClientLogger(sc.Logger)
+	if logger != nil {
+		logSOAPRequest(logger, payload)
+		defer func(started time.Time) {
+			logSOAPDone(logger, soapMethodName(payload), started, err)
+		}(time.Now())
+	}
 
-		body := soapEnvelope(payload)
+	return sc.do(ctx, logger, soapMethodName(payload), func(ctx context.Context) (*http.Request, error) {
+		return newSOAPRequest(ctx, "http://unix/", payload, sc.Compression)
+	}, sc.MaxStaleRetries, v)
+}
 
-		r := bufio.NewReader(c)
+// do sends the request created by the provided function and decodes the
+// response into v. The request is created again for each of up to
+// maxStaleRetries retries on stale connections.
+func (sc *SOAPSocketClient) do(ctx context.Context, logger Logger, method string, newRequest func(context.Context) (*http.Request, error), maxStaleRetries int, v interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
 
-		c.SetWriteDeadline(time.Now().Add(sc.Dialer.Timeout))
-		_, err = body.WriteTo(c)
+	for retry := 0; ; retry++ {
+		var reused bool
+		var conn *countedConn
+		var written int64
+		var getConnStarted time.Time
+		traceCtx := httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GetConn: func(hostPort string) {
+				getConnStarted = time.Now()
+			},
+			GotConn: func(info httptrace.GotConnInfo) {
+				reused = info.Reused
+				if c, ok := info.Conn.(*countedConn); ok {
+					conn = c
+					written = c.bytesWritten()
+				}
+				if sc.OnPoolWait != nil {
+					sc.OnPoolWait(time.Since(getConnStarted))
+				}
+				if sc.OnConnReuse != nil {
+					sc.OnConnReuse(info.Reused)
+				}
+			},
+		})
+
+		req, err := newRequest(traceCtx)
 		if err != nil {
-			// Remove from pool and retry on any write error. This will retry
-			// until the pool is not able to return a socket connection fast
-			// enough anymore.
-			sc.Pool.Remove(c)
-			continue
+			return err
 		}
 
-		// NOTE(longsleep): Kopano SOAP socket return HTTP protocol data.
-		c.SetReadDeadline(time.Now().Add(sc.Dialer.Timeout))
-		resp, err := http.ReadResponse(r, nil)
+		resp, err := sc.Transport.RoundTrip(req)
 		if err != nil {
-			sc.Pool.Remove(c)
-			return fmt.Errorf("failed to read from unix socket: %v", err)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return fmt.Errorf("failed to request from unix socket: %w", ctxErr)
+			}
+			// Retry only if the request did not reach the server, since
+			// it must not be run twice.
+			nothingWritten := conn != nil && conn.bytesWritten() == written
+			if reused && nothingWritten && retry < maxStaleRetries && isStaleConnError(err) {
+				continue
+			}
+			return fmt.Errorf("failed to request from unix socket: %w", err)
+		}
+		defer resp.Body.Close()
+
+		limits := newResponseLimits(sc.MaxResponseSize, sc.MaxResponseDepth)
+		err = readSOAPResponse(ctx, logger, method, resp, v, limits)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return fmt.Errorf("failed to read from unix socket: %w", ctxErr)
+			}
 		}
+		return err
+	}
+}
+
+// dialContext connects to the unix socket of the accociated client, ignoring
+// the provided network and address.
+func (sc *SOAPSocketClient) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var c net.Conn
+	var err error
+	pool := sc.Pool
+	if pool != nil {
+		c, err = getPoolConn(ctx, pool, sc.Dialer.Timeout)
+	} else {
+		c, err = sc.Dialer.DialContext(ctx, "unix", sc.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&sc.poolSize, 1)
+
+	return &countedConn{
+		Conn:  c,
+		count: &sc.poolSize,
+		pool:  pool,
+	}, nil
+}
 
-		canReuseConnection := resp.Header.Get("Connection") == "keep-alive"
-		defer func() {
-			resp.Body.Close()
-			if canReuseConnection {
-				// Close makes the connection available to the pool again.
-				c.Close()
-			} else {
-				sc.Pool.Remove(c)
+// getPoolConn returns a connection of the provided pool. Waiting for the
+// connection is aborted when the provided context is done, in which case a
+// connection returned later is removed from the pool.
+func getPoolConn(ctx context.Context, pool ConnPool, timeout time.Duration) (net.Conn, error) {
+	type result struct {
+		c   net.Conn
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		c, err := pool.GetWithTimeout(timeout)
+		done <- result{c, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.c, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.err == nil {
+				pool.Remove(r.c)
 			}
 		}()
+		return nil, ctx.Err()
+	}
+}
 
-		if resp.StatusCode != http.StatusOK {
-			debugRawResponse(resp.StatusCode, resp.Body)
-			return fmt.Errorf("unexpected http response status: %v", resp.StatusCode)
-		}
+// A countedConn decrements its counter when closed and counts the bytes
+// written to it. Connections taken from a pool are removed from it when
+// closed.
+type countedConn struct {
+	net.Conn
+	count   *int32
+	pool    ConnPool
+	closed  int32
+	written int64
+}
 
-		return parseSOAPResponse(resp.StatusCode, resp.Body, v)
+func (c *countedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.written, int64(n))
+	return n, err
+}
+
+// bytesWritten returns the number of bytes written to the accociated
+// connection.
+func (c *countedConn) bytesWritten() int64 {
+	return atomic.LoadInt64(&c.written)
+}
+
+func (c *countedConn) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		// Already closed or removed from its pool.
+		return nil
+	}
+	atomic.AddInt32(c.count, -1)
+	if c.pool != nil {
+		return c.pool.Remove(c.Conn)
 	}
+	return c.Conn.Close()
 }
 
-func (sc *SOAPSocketClient) connect() (net.Conn, error) {
-	return sc.Dialer.Dial("unix", sc.Path)
+// isStaleConnError returns true for errors which signal that a reused
+// connection was closed by the server.
+func isStaleConnError(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		strings.Contains(err.Error(), "server closed idle connection")
+}
+
+// PoolSize returns the number of currently open connections of the associated
+// SOAPSocketClient.
+func (sc *SOAPSocketClient) PoolSize() int {
+	return int(atomic.LoadInt32(&sc.poolSize))
+}
+
+// SetLogger sets the Logger of the accociated client.
+func (sc *SOAPSocketClient) SetLogger(logger Logger) {
+	sc.Logger = logger
 }
 
 func (sc *SOAPSocketClient) String() string {
@@ -372,3 +800,23 @@ func (s xmlCharData) Escape() string {
 func (s xmlCharData) WriteTo(w io.Writer) error {
 	return xml.EscapeText(w, s)
 }
+
+// writeXMLText writes the provided text XML escaped to the provided builder.
+// Text which needs no escaping is written without intermediate copies.
+func writeXMLText(b *strings.Builder, s string) {
+	for idx := 0; idx < len(s); idx++ {
+		switch c := s[idx]; {
+		case c < 0x20, c >= utf8.RuneSelf, c == '<', c == '>', c == '&', c == '\'', c == '"':
+			b.WriteString(s[:idx])
+			xml.EscapeText(b, []byte(s[idx:]))
+			return
+		}
+	}
+	b.WriteString(s)
+}
+
+// writeUint writes the provided value in decimal to the provided builder.
+func writeUint(b *strings.Builder, v uint64) {
+	var buf [20]byte
+	b.Write(strconv.AppendUint(buf[:0], v, 10))
+}
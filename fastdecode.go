@@ -0,0 +1,258 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// fastDecodeMaxSize is the maximum size of responses which are decoded with
+// the fast decoder. Larger responses are always decoded with encoding/xml.
+const fastDecodeMaxSize = 8 * 1024
+
+// Depths of the elements of a SOAP response, starting at the Envelope.
+const (
+	fastDepthEnvelope = iota + 1
+	fastDepthBody
+	fastDepthResponse
+	fastDepthField
+)
+
+// A fastDecoder is implemented by responses which consist of simple elements
+// only. decodeFastField is called with local name and text of every element
+// of the response and returns false if the value cannot be decoded.
+type fastDecoder interface {
+	decodeFastField(name []byte, value []byte) bool
+}
+
+var fastDecodeBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, fastDecodeMaxSize+1)
+		return &buf
+	},
+}
+
+// parseSOAPResponseFast decodes the response from the provided data into v
+// without encoding/xml if possible, falling back to parseSOAPResponse for
+// large or complex responses.
+func parseSOAPResponseFast(code int, data io.Reader, v fastDecoder, limits responseLimits) error {
+	buf := fastDecodeBufferPool.Get().(*[]byte)
+	defer fastDecodeBufferPool.Put(buf)
+
+	n, err := io.ReadFull(data, *buf)
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		// Complete response is in buffer.
+		if decodeFastResponse((*buf)[:n], v, limits.maxDepth) {
+			return nil
+		}
+		resetResponse(v)
+		return parseSOAPResponse(code, bytes.NewReader((*buf)[:n]), v, limits)
+	case nil:
+		// Response is too large for the fast decoder.
+		return parseSOAPResponse(code, io.MultiReader(bytes.NewReader((*buf)[:n]), data), v, limits)
+	default:
+		return fmt.Errorf("failed to read SOAP response body: %w", err)
+	}
+}
+
+// decodeFastResponse decodes the provided SOAP envelope into v. It returns
+// false if the envelope uses any XML feature beyond simple elements, a SOAP
+// Fault or anything else which needs the full decoder.
+func decodeFastResponse(data []byte, v fastDecoder, maxDepth int) bool {
+	var name, field, value []byte
+	depth := 0
+
+	for pos := 0; pos < len(data); {
+		if data[pos] != '<' {
+			end := bytes.IndexByte(data[pos:], '<')
+			if end < 0 {
+				end = len(data) - pos
+			}
+			text := data[pos : pos+end]
+			if depth == fastDepthField {
+				if bytes.IndexByte(text, '&') >= 0 {
+					return false
+				}
+				value = text
+			} else if len(bytes.TrimSpace(text)) > 0 {
+				return false
+			}
+			pos += end
+			continue
+		}
+
+		end := bytes.IndexByte(data[pos:], '>')
+		if end < 0 {
+			return false
+		}
+		tag := data[pos+1 : pos+end]
+		pos += end + 1
+		if len(tag) == 0 {
+			return false
+		}
+
+		switch tag[0] {
+		case '?':
+			if depth != 0 {
+				return false
+			}
+			continue
+		case '!':
+			// Comments, CDATA and DOCTYPE are left to the full decoder.
+			return false
+		case '/':
+			if depth == fastDepthField {
+				if !bytes.Equal(fastLocalName(tag[1:]), field) || !v.decodeFastField(field, value) {
+					return false
+				}
+			}
+			depth--
+			if depth < fastDepthResponse {
+				return depth == fastDepthBody
+			}
+			continue
+		}
+
+		selfClosing := tag[len(tag)-1] == '/'
+		if bytes.IndexAny(tag, `"'`) >= 0 {
+			// Attribute values might contain '>', so make sure the tag ended.
+			if bytes.Count(tag, []byte{'"'})%2 != 0 || bytes.Count(tag, []byte{'\''})%2 != 0 {
+				return false
+			}
+		}
+		depth++
+		if depth > fastDepthField || (maxDepth > 0 && depth > maxDepth) {
+			return false
+		}
+
+		name = fastLocalName(tag)
+		switch depth {
+		case fastDepthEnvelope:
+			if string(name) != "Envelope" {
+				return false
+			}
+		case fastDepthBody:
+			if string(name) != "Body" {
+				return false
+			}
+		case fastDepthResponse:
+			if string(name) == "Fault" {
+				return false
+			}
+		case fastDepthField:
+			field = name
+			value = nil
+		}
+
+		if selfClosing {
+			if depth == fastDepthField && !v.decodeFastField(field, nil) {
+				return false
+			}
+			depth--
+			if depth < fastDepthResponse {
+				return false
+			}
+		}
+	}
+
+	return false
+}
+
+// fastLocalName returns the local name of the element of the provided tag
+// content, that is the name without namespace prefix and attributes.
+func fastLocalName(tag []byte) []byte {
+	end := bytes.IndexAny(tag, " \t\r\n/")
+	if end < 0 {
+		end = len(tag)
+	}
+	name := tag[:end]
+	if idx := bytes.IndexByte(name, ':'); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return name
+}
+
+// parseFastUint parses the provided decimal value, ignoring surrounding white
+// space.
+func parseFastUint(value []byte) (uint64, bool) {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 || len(value) > 20 {
+		return 0, false
+	}
+
+	var n uint64
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		next := n*10 + uint64(c-'0')
+		if next/10 != n {
+			return 0, false
+		}
+		n = next
+	}
+	return n, true
+}
+
+func (r *LogonResponse) decodeFastField(name []byte, value []byte) bool {
+	var ok bool
+	switch string(name) {
+	case "er":
+		var er uint64
+		er, ok = parseFastUint(value)
+		r.Er = KCError(er)
+	case "ulSessionId":
+		var sessionID uint64
+		sessionID, ok = parseFastUint(value)
+		r.SessionID = KCSessionID(sessionID)
+	case "sServerGuid":
+		r.ServerGUID, ok = string(value), true
+	default:
+		ok = true
+	}
+	return ok
+}
+
+func (r *LogoffResponse) decodeFastField(name []byte, value []byte) bool {
+	if string(name) == "er" {
+		er, ok := parseFastUint(value)
+		r.Er = KCError(er)
+		return ok
+	}
+	return true
+}
+
+func (r *ResolveUserResponse) decodeFastField(name []byte, value []byte) bool {
+	var ok bool
+	switch string(name) {
+	case "er":
+		var er uint64
+		er, ok = parseFastUint(value)
+		r.Er = KCError(er)
+	case "ulUserId":
+		r.ID, ok = parseFastUint(value)
+	case "sUserId":
+		r.UserEntryID, ok = string(value), true
+	default:
+		ok = true
+	}
+	return ok
+}
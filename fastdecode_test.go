@@ -0,0 +1,197 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testLogonResponse = `<ns:logonResponse><er>0</er><ulSessionId>7209797614127530285</ulSessionId><ulCapabilities>1795</ulCapabilities><sServerGuid xsi:type="xsd:base64Binary">3vRKxtyF0UWVeWwZfPaE+g==</sServerGuid><sLicenseResponse/><lpszVersion>8.7.80</lpszVersion><lpszServerName/></ns:logonResponse>`
+
+const testResolveUsernameResponse = `<ns:resolveUsernameResponse><er>0</er><ulUserId>42</ulUserId><sUserId xsi:type="xsd:base64Binary">AAAAAKwhqVBDQE7ss0yqDkWnaG8BAAAABgAAACoAAAA=</sUserId></ns:resolveUsernameResponse>`
+
+// A testRoundTripper answers all requests with the accociated SOAP response
+// without network.
+type testRoundTripper struct {
+	response string
+	header   http.Header
+}
+
+func (rt *testRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        rt.header,
+		Body:          ioutil.NopCloser(strings.NewReader(rt.response)),
+		ContentLength: int64(len(rt.response)),
+		Request:       req,
+	}, nil
+}
+
+func newTestRoundTripKCC(tb testing.TB, body string) *KCC {
+	uri, _ := url.Parse("http://127.0.0.1:236")
+	client, err := NewSOAPHTTPClient(uri, &http.Client{
+		Transport: &testRoundTripper{
+			response: testSOAPResponse(body),
+			header:   http.Header{"Content-Type": []string{"text/xml; charset=utf-8"}},
+		},
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return NewKCCWithClient(client)
+}
+
+func TestParseSOAPResponseFast(t *testing.T) {
+	for idx, body := range []string{
+		testLogonResponse,
+		`<ns:logonResponse><er>2147746063</er><ulSessionId>0</ulSessionId></ns:logonResponse>`,
+		`<ns:logonResponse><er>0</er><ulSessionId>1</ulSessionId><sServerGuid>a&amp;b</sServerGuid></ns:logonResponse>`,
+		`<ns:logonResponse><er>0</er><ulSessionId>1</ulSessionId><sServerGuid><![CDATA[a<b]]></sServerGuid></ns:logonResponse>`,
+		`<ns:logonResponse><!-- comment --><er>0</er><ulSessionId>1</ulSessionId></ns:logonResponse>`,
+		`<ns:logonResponse><er>0</er><ulSessionId>1</ulSessionId><sLicenseResponse><item>1</item></sLicenseResponse></ns:logonResponse>`,
+		`<ns:logonResponse><er>0</er><ulSessionId>1</ulSessionId><lpszVersion>` + strings.Repeat("x", fastDecodeMaxSize) + `</lpszVersion></ns:logonResponse>`,
+	} {
+		data := testSOAPResponse(body)
+
+		var expected LogonResponse
+		expectedErr := parseSOAPResponse(http.StatusOK, strings.NewReader(data), &expected, newResponseLimits(0, 0))
+
+		var resp LogonResponse
+		err := parseSOAPResponseFast(http.StatusOK, strings.NewReader(data), &resp, newResponseLimits(0, 0))
+		if (err == nil) != (expectedErr == nil) {
+			t.Errorf("response %d: unexpected error %v, expected %v", idx, err, expectedErr)
+		}
+		if resp != expected {
+			t.Errorf("response %d: got %+v, expected %+v", idx, resp, expected)
+		}
+	}
+}
+
+func TestParseSOAPResponseFastFallback(t *testing.T) {
+	data := testSOAPResponse(`<SOAP-ENV:Fault><faultcode>SOAP-ENV:Server</faultcode><faultstring>failed</faultstring></SOAP-ENV:Fault>`)
+	var resp LogonResponse
+	err := parseSOAPResponseFast(http.StatusOK, strings.NewReader(data), &resp, newResponseLimits(0, 0))
+	var fault *SOAPFault
+	if !errors.As(err, &fault) {
+		t.Errorf("expected SOAP fault, got %v", err)
+	}
+
+	if decodeFastResponse([]byte(testSOAPResponse(testLogonResponse)), &resp, fastDepthResponse) {
+		t.Errorf("expected fast decoder to respect maximum depth")
+	}
+	if decodeFastResponse([]byte(testSOAPResponse(testLogonResponse)[:200]), &resp, 0) {
+		t.Errorf("expected fast decoder to reject truncated response")
+	}
+}
+
+func TestEnvelopeReader(t *testing.T) {
+	payload := strings.Repeat("<ns:logoff></ns:logoff>", 10)
+	expected := soapHeader + payload + soapFooter
+
+	r := newEnvelopeReader(&payload)
+	if r.Len() != len(expected) {
+		t.Errorf("unexpected length %d, expected %d", r.Len(), len(expected))
+	}
+	var b strings.Builder
+	buf := make([]byte, 7)
+	for {
+		n, err := r.Read(buf)
+		b.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.String() != expected {
+		t.Errorf("unexpected envelope %q", b.String())
+	}
+
+	b.Reset()
+	r = newEnvelopeReader(&payload)
+	r.Read(buf)
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf)+b.String() != expected || r.Len() != 0 {
+		t.Errorf("unexpected envelope %q", string(buf)+b.String())
+	}
+}
+
+func BenchmarkLogonRoundTrip(b *testing.B) {
+	c := newTestRoundTripKCC(b, testLogonResponse)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		resp, err := c.Logon(ctx, "user1", "pass", KOPANO_LOGON_NO_REGISTER_SESSION)
+		if err != nil || resp.SessionID != 7209797614127530285 {
+			b.Fatalf("unexpected logon result: %v %+v", err, resp)
+		}
+	}
+}
+
+func BenchmarkResolveUsernameRoundTrip(b *testing.B) {
+	c := newTestRoundTripKCC(b, testResolveUsernameResponse)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		resp, err := c.ResolveUsername(ctx, "user1", 7209797614127530285)
+		if err != nil || resp.ID != 42 {
+			b.Fatalf("unexpected resolve result: %v %+v", err, resp)
+		}
+	}
+}
+
+func BenchmarkParseLogonResponse(b *testing.B) {
+	data := testSOAPResponse(testLogonResponse)
+	limits := newResponseLimits(0, 0)
+
+	b.Run("xml", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			var resp LogonResponse
+			if err := parseSOAPResponse(http.StatusOK, strings.NewReader(data), &resp, limits); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("fast", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			var resp LogonResponse
+			if err := parseSOAPResponseFast(http.StatusOK, strings.NewReader(data), &resp, limits); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
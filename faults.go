@@ -0,0 +1,249 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A Fault describes the failure injected into a request by a
+// FaultInjectingSOAPClient. Latency is added before the request, all other
+// settings replace the request. If multiple of those are set, the first in
+// field order applies.
+type Fault struct {
+	// Latency delays the request by the given duration.
+	Latency time.Duration
+
+	// Err fails the request with the given error.
+	Err error
+	// ConnectionReset fails the request with a connection reset error.
+	ConnectionReset bool
+	// StatusCode fails the request with an HTTPStatusError.
+	StatusCode int
+	// MalformedResponse fails the request with the error of decoding an
+	// invalid XML response.
+	MalformedResponse bool
+	// KCError answers the request with a response carrying the given error.
+	KCError KCError
+}
+
+// A FaultRule selects the requests into which a Fault is injected.
+type FaultRule struct {
+	// Method limits the rule to requests of the given SOAP method if set.
+	Method string
+
+	// Probability is the chance from 0 to 1 that Fault is injected into a
+	// matching request. It is ignored if Script is set.
+	Probability float64
+	Fault       Fault
+
+	// Script lists the faults injected into consecutive matching requests.
+	// Nil entries let the request pass. Once the script ran out, the rule
+	// does not match anymore.
+	Script []*Fault
+
+	mutex sync.Mutex
+	count int
+}
+
+// next returns the fault to inject into the next request, or nil.
+func (r *FaultRule) next(random func() float64) *Fault {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.Script != nil {
+		if r.count >= len(r.Script) {
+			return nil
+		}
+		fault := r.Script[r.count]
+		r.count++
+		return fault
+	}
+
+	if r.Probability > 0 && random() < r.Probability {
+		return &r.Fault
+	}
+	return nil
+}
+
+// A FaultInjectingSOAPClient wraps a SOAPClient and injects faults into
+// requests according to its rules, to test how applications handle failing
+// servers. The first rule which yields a fault for a request applies.
+type FaultInjectingSOAPClient struct {
+	Client SOAPClient
+	Rules  []*FaultRule
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+// NewFaultInjectingSOAPClient creates a new FaultInjectingSOAPClient wrapping
+// the provided client with the provided rules. The seed initializes the
+// random source for probability based rules.
+func NewFaultInjectingSOAPClient(client SOAPClient, seed int64, rules ...*FaultRule) *FaultInjectingSOAPClient {
+	return &FaultInjectingSOAPClient{
+		Client: client,
+		Rules:  rules,
+
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// DoRequest sends the provided payload data as SOAP through the means of the
+// accociated client, unless a fault replaces the request.
+func (fc *FaultInjectingSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	method := soapMethodName(payload)
+	if fault := fc.fault(method); fault != nil {
+		if injected, err := fault.inject(ctx, method, v); injected {
+			return err
+		}
+	}
+
+	return fc.Client.DoRequest(ctx, payload, v)
+}
+
+// DoStreamRequest sends the payload read from the provided reader as SOAP
+// through the means of the accociated client and calls the provided decoder
+// with the response, unless a fault replaces the request.
+func (fc *FaultInjectingSOAPClient) DoStreamRequest(ctx context.Context, method string, payload io.Reader, decode SOAPResponseDecoder) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if fault := fc.fault(method); fault != nil {
+		if injected, err := fault.inject(ctx, method, &soapStreamResponse{
+			decode: decode,
+		}); injected {
+			return err
+		}
+	}
+
+	return NewSOAPStreamClient(fc.Client).DoStreamRequest(ctx, method, payload, decode)
+}
+
+// SetLogger sets the Logger of the accociated client, if supported.
+func (fc *FaultInjectingSOAPClient) SetLogger(logger Logger) {
+	if setter, ok := fc.Client.(loggerSetter); ok {
+		setter.SetLogger(logger)
+	}
+}
+
+func (fc *FaultInjectingSOAPClient) String() string {
+	return fmt.Sprintf("<faults:%s>", fc.Client)
+}
+
+// fault returns the fault to inject into the next request of the provided
+// method, or nil.
+func (fc *FaultInjectingSOAPClient) fault(method string) *Fault {
+	for _, rule := range fc.Rules {
+		if rule.Method != "" && rule.Method != method {
+			continue
+		}
+		if fault := rule.next(fc.random); fault != nil {
+			return fault
+		}
+	}
+	return nil
+}
+
+// random returns the next random number of the accociated client. Clients
+// which were not created with NewFaultInjectingSOAPClient use a time seeded
+// random source.
+func (fc *FaultInjectingSOAPClient) random() float64 {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	if fc.rand == nil {
+		fc.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return fc.rand.Float64()
+}
+
+// inject applies the accociated fault to a request of the provided method
+// with the provided response. It returns false if the request must be sent
+// after all.
+func (f *Fault) inject(ctx context.Context, method string, v interface{}) (bool, error) {
+	if f.Latency > 0 {
+		timer := time.NewTimer(f.Latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return true, ctx.Err()
+		}
+	}
+
+	switch {
+	case f.Err != nil:
+		return true, f.Err
+	case f.ConnectionReset:
+		return true, &net.OpError{
+			Op:  "read",
+			Net: "tcp",
+			Err: os.NewSyscallError("read", syscall.ECONNRESET),
+		}
+	case f.StatusCode != 0:
+		return true, &HTTPStatusError{
+			StatusCode: f.StatusCode,
+		}
+	case f.MalformedResponse:
+		data := strings.NewReader(soapHeader + "<ns:response><er>0</er")
+		return true, parseSOAPResponse(http.StatusOK, data, v, newResponseLimits(0, 0))
+	case f.KCError != KCSuccess:
+		if _, ok := v.(*soapStreamResponse); ok {
+			// Stream decoders expect a response element to decode.
+			data := strings.NewReader(soapHeader +
+				"<ns:" + method + "Response><er>" +
+				strconv.FormatUint(uint64(f.KCError), 10) +
+				"</er></ns:" + method + "Response>" +
+				soapFooter)
+			return true, parseSOAPResponse(http.StatusOK, data, v, newResponseLimits(0, 0))
+		}
+		return true, setResponseKCError(v, f.KCError)
+	}
+
+	return false, nil
+}
+
+// setResponseKCError sets the Er field of the provided response.
+func setResponseKCError(v interface{}, er KCError) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return er
+	}
+	field := rv.Elem().FieldByName("Er")
+	if !field.IsValid() || !field.CanSet() || field.Type() != reflect.TypeOf(er) {
+		return er
+	}
+	field.Set(reflect.ValueOf(er))
+	return nil
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFaultInjectingSOAPClientScript(t *testing.T) {
+	requests := 0
+	client := NewFaultInjectingSOAPClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		requests++
+		v.(*ResolveUserResponse).ID = 1
+		return nil
+	}), 1, &FaultRule{
+		Method: "resolveUsername",
+		Script: []*Fault{
+			{ConnectionReset: true},
+			{StatusCode: 500},
+			{MalformedResponse: true},
+			{KCError: KCERR_END_OF_SESSION},
+			nil,
+			{Latency: 10 * time.Millisecond},
+		},
+	})
+	c := NewKCCWithClient(client)
+
+	_, err := c.ResolveUsername(context.Background(), "user1", 1)
+	if !errors.Is(err, syscall.ECONNRESET) || !isRetryableTransportError(err) {
+		t.Errorf("expected connection reset error, got %v", err)
+	}
+
+	_, err = c.ResolveUsername(context.Background(), "user1", 1)
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 500 {
+		t.Errorf("expected HTTP status error, got %v", err)
+	}
+
+	if _, err = c.ResolveUsername(context.Background(), "user1", 1); err == nil {
+		t.Errorf("expected error for malformed response")
+	}
+
+	resp, err := c.ResolveUsername(context.Background(), "user1", 1)
+	if err != nil || resp.Er != KCERR_END_OF_SESSION {
+		t.Errorf("expected KCError response, got %v %+v", err, resp)
+	}
+	if requests != 0 {
+		t.Errorf("faulted requests were sent: %d", requests)
+	}
+
+	for idx := 0; idx < 3; idx++ {
+		started := time.Now()
+		resp, err = c.ResolveUsername(context.Background(), "user1", 1)
+		if err != nil || resp.ID != 1 {
+			t.Errorf("request %d was not passed through: %v %+v", idx, err, resp)
+		}
+		if idx == 1 && time.Since(started) < 10*time.Millisecond {
+			t.Errorf("latency was not injected")
+		}
+	}
+	if requests != 3 {
+		t.Errorf("unexpected number of passed requests: %d", requests)
+	}
+}
+
+func TestFaultInjectingSOAPClientProbability(t *testing.T) {
+	client := NewFaultInjectingSOAPClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		return nil
+	}), 42, &FaultRule{
+		Method:      "getUser",
+		Probability: 0.5,
+		Fault: Fault{
+			KCError: KCERR_NETWORK_ERROR,
+		},
+	})
+
+	faulted := 0
+	for idx := 0; idx < 1000; idx++ {
+		payload := "<ns:getUser></ns:getUser>"
+		var resp GetUserResponse
+		if err := client.DoRequest(context.Background(), &payload, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Er == KCERR_NETWORK_ERROR {
+			faulted++
+		}
+
+		payload = "<ns:resolveUsername></ns:resolveUsername>"
+		var other ResolveUserResponse
+		if err := client.DoRequest(context.Background(), &payload, &other); err != nil || other.Er != KCSuccess {
+			t.Fatalf("fault injected into other method: %v %+v", err, other)
+		}
+	}
+	if faulted < 400 || faulted > 600 {
+		t.Errorf("unexpected number of faulted requests: %d", faulted)
+	}
+}
+
+func TestFaultInjectingSOAPClientLiteral(t *testing.T) {
+	client := &FaultInjectingSOAPClient{
+		Client: testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+			return nil
+		}),
+		Rules: []*FaultRule{{
+			Probability: 1,
+			Fault: Fault{
+				KCError: KCERR_NETWORK_ERROR,
+			},
+		}},
+	}
+
+	done := make(chan struct{})
+	for idx := 0; idx < 2; idx++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			resp, err := NewKCCWithClient(client).ResolveUsername(context.Background(), "user1", 1)
+			if err != nil || resp.Er != KCERR_NETWORK_ERROR {
+				t.Errorf("fault was not injected: %v %+v", err, resp)
+			}
+		}()
+	}
+	<-done
+	<-done
+}
+
+func TestFaultInjectingSOAPClientDoStreamRequest(t *testing.T) {
+	inner := &testSOAPStreamClient{response: testResolveUsernameResponse}
+	client := NewFaultInjectingSOAPClient(inner, 1, &FaultRule{
+		Method: "resolveUsername",
+		Script: []*Fault{
+			{KCError: KCERR_NOT_FOUND},
+			nil,
+		},
+	})
+
+	for idx, expected := range []ResolveUserResponse{
+		{Er: KCERR_NOT_FOUND},
+		{ID: 42},
+	} {
+		var resp ResolveUserResponse
+		err := client.DoStreamRequest(context.Background(), "resolveUsername", strings.NewReader("<ns:resolveUsername/>"), func(d *xml.Decoder, start xml.StartElement) error {
+			return d.DecodeElement(&resp, &start)
+		})
+		if err != nil || resp.Er != expected.Er || resp.ID != expected.ID {
+			t.Errorf("unexpected response %d: %v %+v", idx, err, resp)
+		}
+	}
+	if inner.attempts != 1 || !inner.streamed {
+		t.Errorf("unexpected requests: %d attempts, streamed %v", inner.attempts, inner.streamed)
+	}
+}
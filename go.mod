@@ -1,19 +1,19 @@
 module stash.kopano.io/kgol/kcc-go/v5
 
-go 1.13
+go 1.15
 
 require (
-	github.com/eternnoir/gncp v0.0.0-20170707042257-c70df2d0cd68
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/longsleep/go-metrics v0.0.0-20170706183227-c1943bcf9047
 	github.com/onsi/ginkgo v1.10.3 // indirect
 	github.com/onsi/gomega v1.7.1 // indirect
-	github.com/sirupsen/logrus v1.0.3
+	github.com/prometheus/client_golang v1.7.1
+	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/cobra v0.0.1
 	github.com/spf13/pflag v1.0.0 // indirect
-	github.com/stretchr/testify v1.4.0 // indirect
-	golang.org/x/crypto v0.0.0-20170711145318-dd85ac7e6a88 // indirect
-	golang.org/x/net v0.0.0-20180906233101-161cd47e91fd
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
+	golang.org/x/net v0.0.0-20190613194153-d28f0bde5980
 	gopkg.in/airbrake/gobrake.v2 v2.0.9 // indirect
 	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
 )
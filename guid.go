@@ -19,14 +19,120 @@ package kcc
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
 )
 
 var (
 	// MUIDECSAB is the GUID used in AB EntryIDs (ABEID). Definition copied
 	// from kopanocore/common/include/kopano/ECGuid.h
 	MUIDECSAB = DEFINE_GUID(0x50a921ac, 0xd340, 0x48ee, [8]byte{0xb3, 0x19, 0xfb, 0xa7, 0x53, 0x30, 0x44, 0x25})
+	// MUIDZCSAB is the GUID used in Kopano contact provider EntryIDs. Definition
+	// copied from kopanocore/provider/contacts/ZCABData.h
+	MUIDZCSAB = DEFINE_GUID(0x30047f72, 0x92e3, 0xda4f, [8]byte{0xb8, 0x6a, 0xe5, 0x2a, 0x7f, 0xe4, 0x6b, 0x55})
+	// MUIDOneOff is the GUID used in one-off EntryIDs. Definition copied from
+	// mapi4linux/include/mapiguid.h (muidOOP).
+	MUIDOneOff = DEFINE_GUID(0xa41f2b81, 0xa3be, 0x1910, [8]byte{0x9d, 0x6e, 0x00, 0xdd, 0x01, 0x0f, 0x54, 0x02})
+	// MUIDStoreWrap is the GUID used in wrapped store EntryIDs. Definition
+	// copied from mapi4linux/include/mapiguid.h (muidStoreWrap).
+	MUIDStoreWrap = DEFINE_GUID(0x10bba138, 0xe505, 0x1a10, [8]byte{0xa1, 0xbb, 0x08, 0x00, 0x2b, 0x2a, 0x56, 0xc2})
+	// MUIDStore is the Kopano store provider UID used in unwrapped store
+	// EntryIDs. It has the same value as KOPANO_SERVICE_GUID.
+	MUIDStore = DEFINE_GUID(0x3c253dca, 0xd227, 0x443c, [8]byte{0x94, 0xfe, 0x42, 0x56, 0x94, 0xfb, 0x49, 0x21})
+
+	// KOPANO_SERVICE_GUID is the Kopano store provider UID. Definition and
+	// the following Kopano store GUIDs copied from
+	// kopanocore/common/include/kopano/ECGuid.h
+	KOPANO_SERVICE_GUID        = DEFINE_GUID(0x3c253dca, 0xd227, 0x443c, [8]byte{0x94, 0xfe, 0x42, 0x56, 0x94, 0xfb, 0x49, 0x21})
+	KOPANO_STORE_PUBLIC_GUID   = DEFINE_GUID(0xd47f4a09, 0xd3bd, 0x493c, [8]byte{0xb2, 0xfc, 0x3c, 0x90, 0xbb, 0xcb, 0x48, 0xd4})
+	KOPANO_STORE_DELEGATE_GUID = DEFINE_GUID(0x7c7c1085, 0xbc6d, 0x4e53, [8]byte{0x9d, 0xab, 0x8a, 0x53, 0xf8, 0xde, 0xf8, 0x08})
+	KOPANO_STORE_ARCHIVE_GUID  = DEFINE_GUID(0xbc8953ad, 0x2e3f, 0x4172, [8]byte{0x94, 0x04, 0x89, 0x6f, 0xf4, 0x59, 0x87, 0x0f})
+)
+
+// Well-known MAPI property set GUIDs as defined in mapi4linux/include/mapiguid.h
+// and https://docs.microsoft.com/en-us/office/client-developer/outlook/mapi/mapi-constants.
+var (
+	PS_MAPI            = DEFINE_GUID(0x00020328, 0x0000, 0x0000, [8]byte{0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46})
+	PS_PUBLIC_STRINGS  = DEFINE_GUID(0x00020329, 0x0000, 0x0000, [8]byte{0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46})
+	PSETID_Appointment = DEFINE_GUID(0x00062002, 0x0000, 0x0000, [8]byte{0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46})
+	PSETID_Task        = DEFINE_GUID(0x00062003, 0x0000, 0x0000, [8]byte{0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46})
+	PSETID_Address     = DEFINE_GUID(0x00062004, 0x0000, 0x0000, [8]byte{0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46})
+	PSETID_Common      = DEFINE_GUID(0x00062008, 0x0000, 0x0000, [8]byte{0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46})
 )
 
+// GUID is the type representing GUIDs in their binary (little endian) form as
+// used in MAPI data structures.
+type GUID [16]byte
+
+// ParseGUID parses the provided registry format GUID string, with or without
+// surrounding curly braces, into a GUID.
+func ParseGUID(s string) (GUID, error) {
+	var guid GUID
+
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
+	}
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return guid, fmt.Errorf("invalid GUID format")
+	}
+
+	var b [16]byte
+	if _, err := hex.Decode(b[:], []byte(s[0:8]+s[9:13]+s[14:18]+s[19:23]+s[24:])); err != nil {
+		return guid, fmt.Errorf("invalid GUID value: %v", err)
+	}
+
+	return DEFINE_GUID(
+		binary.BigEndian.Uint32(b[0:4]),
+		binary.BigEndian.Uint16(b[4:6]),
+		binary.BigEndian.Uint16(b[6:8]),
+		[8]byte{b[8], b[9], b[10], b[11], b[12], b[13], b[14], b[15]},
+	), nil
+}
+
+// String returns the associated GUID in registry format.
+func (guid GUID) String() string {
+	return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}",
+		binary.LittleEndian.Uint32(guid[0:4]),
+		binary.LittleEndian.Uint16(guid[4:6]),
+		binary.LittleEndian.Uint16(guid[6:8]),
+		guid[8:10],
+		guid[10:16],
+	)
+}
+
+// Equal returns true if the associated GUID is equal to the provided GUID.
+func (guid GUID) Equal(other GUID) bool {
+	return guid == other
+}
+
+// Compare returns an integer comparing the binary form of the associated GUID
+// with the provided GUID. The result is 0 if both are equal, -1 if the
+// associated GUID is less than the other and +1 otherwise.
+func (guid GUID) Compare(other GUID) int {
+	return bytes.Compare(guid[:], other[:])
+}
+
+// IsZero returns true if all bytes of the associated GUID are zero.
+func (guid GUID) IsZero() bool {
+	return guid == GUID{}
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (guid GUID) MarshalText() ([]byte, error) {
+	return []byte(guid.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (guid *GUID) UnmarshalText(text []byte) error {
+	parsed, err := ParseGUID(string(text))
+	if err != nil {
+		return err
+	}
+	*guid = parsed
+	return nil
+}
+
 type guidBytes struct {
 	Data1 uint32
 	Data2 uint16
@@ -35,7 +141,7 @@ type guidBytes struct {
 }
 
 // DEFINE_GUID is a helper to define byte representations of GUIDs.
-func DEFINE_GUID(l uint32, w1, w2 uint16, b [8]byte) [16]byte {
+func DEFINE_GUID(l uint32, w1, w2 uint16, b [8]byte) GUID {
 	guid := guidBytes{
 		l,
 		w1,
@@ -49,7 +155,7 @@ func DEFINE_GUID(l uint32, w1, w2 uint16, b [8]byte) [16]byte {
 		panic(err)
 	}
 
-	var res [16]byte
+	var res GUID
 	copy(res[:], buf.Bytes())
 
 	return res
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGUIDString(t *testing.T) {
+	values := map[string]GUID{
+		"{50A921AC-D340-48EE-B319-FBA753304425}": MUIDECSAB,
+		"{10BBA138-E505-1A10-A1BB-08002B2A56C2}": MUIDStoreWrap,
+		"{3C253DCA-D227-443C-94FE-425694FB4921}": MUIDStore,
+		"{00020329-0000-0000-C000-000000000046}": PS_PUBLIC_STRINGS,
+		"{00062002-0000-0000-C000-000000000046}": PSETID_Appointment,
+	}
+
+	for s, guid := range values {
+		if guid.String() != s {
+			t.Errorf("GUID string value mismatch got %v, wanted %v", guid.String(), s)
+		}
+	}
+}
+
+func TestParseGUID(t *testing.T) {
+	valid := []string{
+		"{50A921AC-D340-48EE-B319-FBA753304425}",
+		"50a921ac-d340-48ee-b319-fba753304425",
+	}
+	invalid := []string{
+		"",
+		"{50A921AC-D340-48EE-B319-FBA753304425",
+		"50A921ACD34048EEB319FBA753304425",
+		"{50A921AC-D340-48EE-B319-FBA75330442X}",
+	}
+
+	for _, s := range valid {
+		guid, err := ParseGUID(s)
+		if err != nil {
+			t.Errorf("GUID parse of %v failed: %v", s, err)
+			continue
+		}
+		if !guid.Equal(MUIDECSAB) {
+			t.Errorf("GUID parse of %v returned unexpected value: %v", s, guid)
+		}
+	}
+	for _, s := range invalid {
+		if _, err := ParseGUID(s); err == nil {
+			t.Errorf("GUID parse of %v succeeded while it should fail", s)
+		}
+	}
+}
+
+func TestGUIDJSON(t *testing.T) {
+	data, err := json.Marshal(map[string]GUID{"guid": PSETID_Address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"guid":"{00062004-0000-0000-C000-000000000046}"}` {
+		t.Errorf("GUID JSON value mismatch got %s", data)
+	}
+
+	var v map[string]GUID
+	if err = json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v["guid"] != PSETID_Address {
+		t.Errorf("GUID JSON round trip mismatch got %v", v["guid"])
+	}
+	if PSETID_Address.Compare(PSETID_Common) != -1 || PSETID_Common.Compare(PSETID_Address) != 1 {
+		t.Error("GUID compare returned unexpected result")
+	}
+}
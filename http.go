@@ -18,98 +18,80 @@ package kcc
 
 import (
 	"fmt"
-	"net"
 	"net/http"
-	"net/http/cookiejar"
-	"os"
-	"strconv"
-	"time"
-
-	"golang.org/x/net/publicsuffix"
 )
 
 // DefaultHTTPClient is the default Client as used by KCC for HTTP SOAP requests.
 var DefaultHTTPClient *http.Client
 
-var (
-	defaultHTTPTimeoutSeconds         int64 = 10
-	defaultHTTPMaxIdleConns                 = 100
-	defaultHTTPMaxIdleConnsPerHost          = 100
-	defaultHTTPIdleConnTimeoutSeconds int64 = 90
-	defaultHTTPDialTimeoutSeconds     int64 = 30
-	defaultHTTPKeepAliveSeconds       int64 = 120
-	defaultHTTPDualStack                    = true
-)
-
 var defaultHTTPTransport *http.Transport
 
+// init creates the DefaultHTTPClient from the built-in defaults and the
+// KCC_GO_HTTP_* environment variables.
 func init() {
-	debug = os.Getenv("KCC_GO_DEBUG") != ""
+	cfg := NewConfig(WithEnvironment())
 
-	if s := os.Getenv("KCC_GO_HTTP_TIMEOUT"); s != "" {
-		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
-			defaultHTTPTimeoutSeconds = n
-		}
-	}
-	if s := os.Getenv("KCC_GO_HTTP_MAX_IDLE_CONNS"); s != "" {
-		if n, err := strconv.ParseInt(s, 10, 0); err == nil {
-			defaultHTTPMaxIdleConns = int(n)
-		}
+	var err error
+	DefaultHTTPClient, err = cfg.newHTTPClient()
+	if err != nil {
+		panic(err)
 	}
-	if s := os.Getenv("KCC_GO_HTTP_MAX_IDLE_CONNS_PER_HOST"); s != "" {
-		if n, err := strconv.ParseInt(s, 10, 0); err == nil {
-			defaultHTTPMaxIdleConnsPerHost = int(n)
-		}
+	defaultHTTPTransport = DefaultHTTPClient.Transport.(*http.Transport)
+
+	if DefaultLogger != nil && DefaultLogger.Enabled(LogLevelDebug) {
+		DefaultLogger.Log(LogLevelDebug, "HTTP client", map[string]interface{}{
+			"client":    fmt.Sprintf("%+v", DefaultHTTPClient),
+			"transport": fmt.Sprintf("%+v", defaultHTTPTransport),
+		})
 	}
-	if s := os.Getenv("KCC_GO_HTTP_IDLE_CONN_TIMEOUT"); s != "" {
-		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
-			defaultHTTPIdleConnTimeoutSeconds = n
-		}
+}
+
+// httpClient returns the http.Client for HTTP SOAP requests of the accociated
+// config. If a proxy or TLS settings are configured, they are applied to a
+// copy of the configured client, or the DefaultHTTPClient, and its transport,
+// leaving the original untouched. The copy has no cookie jar, so that clients
+// with different proxy or TLS settings do not share cookies.
+func (config *SOAPClientConfig) httpClient() (*http.Client, error) {
+	if config.Proxy == nil && config.TLSClientConfig == nil && config.RootCAs == nil && len(config.PinnedSPKI) == 0 {
+		return config.HTTPClient, nil
 	}
-	if s := os.Getenv("KCC_GO_HTTP_DIAL_TIMEOUT"); s != "" {
-		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
-			defaultHTTPDialTimeoutSeconds = n
-		}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = DefaultHTTPClient
 	}
-	if s := os.Getenv("KCC_GO_HTTP_KEEPALIVE"); s != "" {
-		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
-			defaultHTTPKeepAliveSeconds = n
-		}
+
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, fmt.Errorf("proxy and TLS settings need a http.Transport, got %T", t)
 	}
-	if s := os.Getenv("KCC_GO_HTTP_DUALSTACK"); s != "" {
-		switch s {
-		case "off", "false", "no":
-			defaultHTTPDualStack = false
-		case "on", "true", "yes":
-			defaultHTTPDualStack = true
+
+	if config.Proxy != nil {
+		switch config.Proxy.Scheme {
+		case "http", "https", "socks5", "socks5h":
+			transport.Proxy = http.ProxyURL(config.Proxy)
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme '%v'", config.Proxy.Scheme)
 		}
 	}
 
-	jar, err := cookiejar.New(&cookiejar.Options{
-		PublicSuffixList: publicsuffix.List,
-	})
-	if err != nil {
-		panic(err)
+	tlsConfig := config.TLSClientConfig
+	if tlsConfig == nil {
+		tlsConfig = transport.TLSClientConfig
 	}
-
-	defaultHTTPTransport = http.DefaultTransport.(*http.Transport).Clone()
-	defaultHTTPTransport.DialContext = (&net.Dialer{
-		Timeout:   time.Duration(defaultHTTPDialTimeoutSeconds) * time.Second,
-		KeepAlive: time.Duration(defaultHTTPKeepAliveSeconds) * time.Second,
-		DualStack: defaultHTTPDualStack,
-	}).DialContext
-	defaultHTTPTransport.MaxIdleConns = defaultHTTPMaxIdleConns
-	defaultHTTPTransport.MaxIdleConnsPerHost = defaultHTTPMaxIdleConnsPerHost
-	defaultHTTPTransport.IdleConnTimeout = time.Duration(defaultHTTPIdleConnTimeoutSeconds) * time.Second
-
-	DefaultHTTPClient = &http.Client{
-		Jar:       jar,
-		Timeout:   time.Duration(defaultHTTPTimeoutSeconds) * time.Second,
-		Transport: defaultHTTPTransport,
+	tlsConfig, err := newTLSClientConfig(tlsConfig, config.RootCAs, config.PinnedSPKI)
+	if err != nil {
+		return nil, err
 	}
+	transport.TLSClientConfig = tlsConfig
 
-	if debug {
-		fmt.Printf("HTTP client: %+v\n", DefaultHTTPClient)
-		fmt.Printf("HTTP client transport: %+v\n", defaultHTTPTransport)
-	}
+	c := *client
+	c.Transport = transport
+	c.Jar = nil
+	return &c, nil
 }
@@ -0,0 +1,178 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// A SOAPCall describes a single SOAP request as seen by SOAPInterceptors.
+// Duration, Er and ResponseSize are set when the invoker passed to the
+// interceptor returns and describe the part of the chain run by that invoker.
+type SOAPCall struct {
+	Method      string
+	SessionID   KCSessionID
+	PayloadSize int
+
+	Duration     time.Duration
+	Er           KCError
+	ResponseSize int
+}
+
+// A SOAPInvoker sends a SOAP request with the provided payload and decodes the
+// response into v.
+type SOAPInvoker func(ctx context.Context, payload *string, v interface{}) error
+
+// A SOAPInterceptor intercepts SOAP requests. Interceptors must call the
+// provided invoker to continue the chain and may alter the context, payload
+// and results.
+type SOAPInterceptor func(ctx context.Context, call *SOAPCall, payload *string, v interface{}, invoker SOAPInvoker) error
+
+// A chainedSOAPClient runs a chain of SOAPInterceptors around the DoRequest
+// function of a SOAPClient.
+type chainedSOAPClient struct {
+	base         SOAPClient
+	interceptors []SOAPInterceptor
+}
+
+// ChainSOAPClient returns a SOAPClient which runs the provided interceptors
+// around each request of the provided base client. The first interceptor is
+// the outermost one. Since interceptors operate on the complete payload, the
+// returned client does not implement SOAPStreamClient and streamed payloads
+// are read into memory by NewSOAPStreamClient.
+func ChainSOAPClient(base SOAPClient, interceptors ...SOAPInterceptor) SOAPClient {
+	if len(interceptors) == 0 {
+		return base
+	}
+
+	return &chainedSOAPClient{
+		base:         base,
+		interceptors: interceptors,
+	}
+}
+
+// DoRequest sends the provided payload data as SOAP through the accociated
+// interceptors and base client.
+func (cc *chainedSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	call := &SOAPCall{
+		Method:    soapMethodName(payload),
+		SessionID: soapSessionID(payload),
+	}
+	if payload != nil {
+		call.PayloadSize = len(*payload)
+	}
+
+	var responseSize int64
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = context.WithValue(ctx, responseSizeContextKey{}, &responseSize)
+
+	return cc.invoker(0, call, &responseSize)(ctx, payload, v)
+}
+
+func (cc *chainedSOAPClient) invoker(idx int, call *SOAPCall, responseSize *int64) SOAPInvoker {
+	if idx == len(cc.interceptors) {
+		return cc.base.DoRequest
+	}
+
+	next := cc.invoker(idx+1, call, responseSize)
+	return func(ctx context.Context, payload *string, v interface{}) error {
+		return cc.interceptors[idx](ctx, call, payload, v, func(ctx context.Context, payload *string, v interface{}) error {
+			counted := *responseSize
+			started := time.Now()
+			err := next(ctx, payload, v)
+			call.Duration = time.Since(started)
+			call.Er = responseKCError(v)
+			call.ResponseSize = int(*responseSize - counted)
+
+			return err
+		})
+	}
+}
+
+// SetLogger sets the Logger of the accociated base client, if supported.
+func (cc *chainedSOAPClient) SetLogger(logger Logger) {
+	if setter, ok := cc.base.(loggerSetter); ok {
+		setter.SetLogger(logger)
+	}
+}
+
+func (cc *chainedSOAPClient) String() string {
+	return fmt.Sprintf("<chain:%s>", cc.base)
+}
+
+type httpHeaderContextKey struct{}
+
+// ContextWithHTTPHeader returns a copy of the provided context which carries
+// the provided HTTP header. SOAP clients using HTTP add those headers to their
+// requests, which allows interceptors to inject headers.
+func ContextWithHTTPHeader(ctx context.Context, header http.Header) context.Context {
+	if existing, ok := ctx.Value(httpHeaderContextKey{}).(http.Header); ok {
+		merged := existing.Clone()
+		for key, values := range header {
+			merged[key] = append(merged[key], values...)
+		}
+		header = merged
+	}
+
+	return context.WithValue(ctx, httpHeaderContextKey{}, header)
+}
+
+// HTTPHeaderFromContext returns the HTTP header added to the provided context
+// with ContextWithHTTPHeader.
+func HTTPHeaderFromContext(ctx context.Context) (http.Header, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	header, ok := ctx.Value(httpHeaderContextKey{}).(http.Header)
+	return header, ok
+}
+
+type responseSizeContextKey struct{}
+
+// A countingReader counts the bytes read from its reader.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	*cr.n += int64(n)
+	return n, err
+}
+
+// countResponse returns a reader which counts the bytes read from the provided
+// response body, if the provided context was created by a chainedSOAPClient.
+// Otherwise the body is returned unchanged.
+func countResponse(ctx context.Context, body io.Reader) io.Reader {
+	if ctx == nil {
+		return body
+	}
+	if n, ok := ctx.Value(responseSizeContextKey{}).(*int64); ok {
+		return &countingReader{
+			r: body,
+			n: n,
+		}
+	}
+	return body
+}
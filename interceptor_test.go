@@ -0,0 +1,78 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func testSOAPResponse(body string) string {
+	return soapHeader + body + soapFooter
+}
+
+func TestChainSOAPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Test-Auth") != "secret" {
+			http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(rw, testSOAPResponse("<ns:resolveUsernameResponse><er>2147483650</er></ns:resolveUsernameResponse>"))
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	base, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	var seen SOAPCall
+	client := ChainSOAPClient(base,
+		func(ctx context.Context, call *SOAPCall, payload *string, v interface{}, invoker SOAPInvoker) error {
+			order = append(order, "outer")
+			err := invoker(ctx, payload, v)
+			seen = *call
+			return err
+		},
+		func(ctx context.Context, call *SOAPCall, payload *string, v interface{}, invoker SOAPInvoker) error {
+			order = append(order, "inner")
+			ctx = ContextWithHTTPHeader(ctx, http.Header{"X-Test-Auth": []string{"secret"}})
+			return invoker(ctx, payload, v)
+		},
+	)
+
+	c := NewKCCWithClient(client)
+	response, err := c.ResolveUsername(context.Background(), "user1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Er != KCERR_NOT_FOUND {
+		t.Errorf("unexpected response er: %v", response.Er)
+	}
+	if len(order) != 2 || order[0] != "outer" || order[1] != "inner" {
+		t.Errorf("unexpected interceptor order: %v", order)
+	}
+	if seen.Method != "resolveUsername" || seen.SessionID != 1 || seen.PayloadSize == 0 || seen.Duration == 0 || seen.Er != KCERR_NOT_FOUND || seen.ResponseSize == 0 {
+		t.Errorf("unexpected call info: %+v", seen)
+	}
+}
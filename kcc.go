@@ -24,6 +24,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -38,14 +39,21 @@ var (
 	ClientVersion = 8
 )
 
-var debug = false
+// Capacities reserved for the markup and the numbers of requests, so that
+// the payload is built with a single allocation unless text needs escaping.
+// Unsigned numbers have at most 20 digits.
+const (
+	// 242 bytes of logon and ssoLogon markup and up to three numbers.
+	logonPayloadSize = 320
+	// 97 bytes of resolveUsername markup and the session ID.
+	resolveUsernamePayloadSize = 120
+)
 
 func init() {
 	uri := os.Getenv("KOPANO_SERVER_DEFAULT_URI")
 	if uri != "" {
 		DefaultURI = uri
 	}
-	debug = os.Getenv("KCC_GO_DEBUG") != ""
 }
 
 // A KCC is the client implementation base object containing the HTTP connection
@@ -54,7 +62,13 @@ type KCC struct {
 	Client       SOAPClient
 	Capabilities KCFlag
 
-	app [2]string
+	// SessionEventHandler is called for lifecycle events of Sessions created
+	// with the associated KCC if set.
+	SessionEventHandler func(session *Session, event SessionEvent)
+
+	app                        [2]string
+	clientVersion              int
+	sessionAutorefreshInterval time.Duration
 }
 
 // NewKCC constructs a KCC instance with the provided URI. If no URI is passed,
@@ -96,6 +110,24 @@ func (c *KCC) String() string {
 	return fmt.Sprintf("KCC(%s)", c.Client)
 }
 
+// autorefreshInterval returns the interval in which Sessions of the accociated
+// KCC are refreshed automatically. A nil KCC uses SessionAutorefreshInterval.
+func (c *KCC) autorefreshInterval() time.Duration {
+	if c != nil && c.sessionAutorefreshInterval > 0 {
+		return c.sessionAutorefreshInterval
+	}
+	return SessionAutorefreshInterval
+}
+
+// version returns the client version sent with logon requests of the
+// accociated KCC. Unless set by its Config, it is the current ClientVersion.
+func (c *KCC) version() int {
+	if c.clientVersion > 0 {
+		return c.clientVersion
+	}
+	return ClientVersion
+}
+
 // SetClientApp sets the clients app details as sent with requests to the
 // accociated server.
 func (c *KCC) SetClientApp(name, version string) error {
@@ -106,20 +138,21 @@ func (c *KCC) SetClientApp(name, version string) error {
 // Logon creates a session with the Kopano server using the provided credentials.
 func (c *KCC) Logon(ctx context.Context, username, password string, logonFlags KCFlag) (*LogonResponse, error) {
 	var b strings.Builder
+	b.Grow(logonPayloadSize + len(username) + len(password) + len(c.app[0]) + len(c.app[1]))
 	b.WriteString("<ns:logon><szUsername>")
-	b.WriteString(xmlCharData(username).Escape())
+	writeXMLText(&b, username)
 	b.WriteString("</szUsername><szPassword>")
-	b.WriteString(xmlCharData(password).Escape())
+	writeXMLText(&b, password)
 	b.WriteString("</szPassword><szImpersonateUser/><ulCapabilities>")
-	b.WriteString(c.Capabilities.String())
+	writeUint(&b, uint64(c.Capabilities))
 	b.WriteString("</ulCapabilities><ulFlags>")
-	b.WriteString(logonFlags.String())
+	writeUint(&b, uint64(logonFlags))
 	b.WriteString("</ulFlags><szClientApp>")
-	b.WriteString(xmlCharData(c.app[0]).Escape())
+	writeXMLText(&b, c.app[0])
 	b.WriteString("</szClientApp><szClientAppVersion>")
-	b.WriteString(xmlCharData(c.app[1]).Escape())
+	writeXMLText(&b, c.app[1])
 	b.WriteString("</szClientAppVersion><clientVersion>")
-	b.WriteString(strconv.FormatInt(int64(ClientVersion), 10))
+	b.WriteString(strconv.FormatInt(int64(c.version()), 10))
 	b.WriteString("</clientVersion></ns:logon>")
 	payload := b.String()
 
@@ -144,20 +177,21 @@ func (c *KCC) SSOLogon(ctx context.Context, prefix SSOType, username string, inp
 	// SSOLogon. This means, a new session is created when none was given and
 	// the call will fail with error if the given session does not exist.
 	var b strings.Builder
+	b.Grow(logonPayloadSize + len(username) + base64.StdEncoding.EncodedLen(len(lpInput)) + len(c.app[0]) + len(c.app[1]))
 	b.WriteString("<ns:ssoLogon><szUsername>")
-	b.WriteString(xmlCharData(username).Escape())
+	writeXMLText(&b, username)
 	b.WriteString("</szUsername><lpInput>")
 	b.WriteString(base64.StdEncoding.EncodeToString(lpInput))
 	b.WriteString("</lpInput><szImpersonateUser/><clientCaps>")
-	b.WriteString(c.Capabilities.String())
+	writeUint(&b, uint64(c.Capabilities))
 	b.WriteString("</clientCaps><szClientApp>")
-	b.WriteString(xmlCharData(c.app[0]).Escape())
+	writeXMLText(&b, c.app[0])
 	b.WriteString("</szClientApp><szClientAppVersion>")
-	b.WriteString(xmlCharData(c.app[1]).Escape())
+	writeXMLText(&b, c.app[1])
 	b.WriteString("</szClientAppVersion><clientVersion>")
-	b.WriteString(strconv.FormatInt(int64(ClientVersion), 10))
+	b.WriteString(strconv.FormatInt(int64(c.version()), 10))
 	b.WriteString("</clientVersion><ulSessionId>")
-	b.WriteString(sessionID.String())
+	writeUint(&b, uint64(sessionID))
 	b.WriteString("</ulSessionId></ns:ssoLogon>")
 	payload := b.String()
 
@@ -183,10 +217,11 @@ func (c *KCC) Logoff(ctx context.Context, sessionID KCSessionID) (*LogoffRespons
 // provided session.
 func (c *KCC) ResolveUsername(ctx context.Context, username string, sessionID KCSessionID) (*ResolveUserResponse, error) {
 	var b strings.Builder
+	b.Grow(resolveUsernamePayloadSize + len(username))
 	b.WriteString("<ns:resolveUsername><lpszUsername>")
-	b.WriteString(xmlCharData(username).Escape())
+	writeXMLText(&b, username)
 	b.WriteString("</lpszUsername><ulSessionId>")
-	b.WriteString(sessionID.String())
+	writeUint(&b, uint64(sessionID))
 	b.WriteString("</ulSessionId></ns:resolveUsername>")
 	payload := b.String()
 
@@ -216,13 +251,47 @@ func (c *KCC) GetUser(ctx context.Context, userEntryID string, sessionID KCSessi
 // ABResolveNames searches the AB for the provided props using the provided
 // request data and flags.
 func (c *KCC) ABResolveNames(ctx context.Context, props []PT, request map[PT]interface{}, requestFlags ABFlag, sessionID KCSessionID, resolveNamesFlags KCFlag) (*ABResolveNamesResponse, error) {
+	payload, err := abResolveNamesPayload(props, request, requestFlags, sessionID, resolveNamesFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	var abResolveNamesResponse ABResolveNamesResponse
+	err = c.Client.DoRequest(ctx, &payload, &abResolveNamesResponse)
+
+	return &abResolveNamesResponse, err
+}
+
+// ABResolveNamesStream searches the AB like ABResolveNames, but passes each
+// row of the result to the provided handler while the response is decoded
+// instead of returning all rows at once. An error returned by the handler
+// aborts the request. Once rows were passed to the handler, the request is
+// neither retried nor failed over, so that no row is passed twice; the error
+// is returned instead.
+func (c *KCC) ABResolveNamesStream(ctx context.Context, props []PT, request map[PT]interface{}, requestFlags ABFlag, sessionID KCSessionID, resolveNamesFlags KCFlag, handler func(row *PropTagRowSet) error) (*ABResolveNamesStreamResponse, error) {
+	payload, err := abResolveNamesPayload(props, request, requestFlags, sessionID, resolveNamesFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	abResolveNamesResponse := ABResolveNamesStreamResponse{
+		RowSet: PropTagRowSetStream{
+			Handler: handler,
+		},
+	}
+	err = c.Client.DoRequest(ctx, &payload, &abResolveNamesResponse)
+
+	return &abResolveNamesResponse, err
+}
+
+func abResolveNamesPayload(props []PT, request map[PT]interface{}, requestFlags ABFlag, sessionID KCSessionID, resolveNamesFlags KCFlag) (string, error) {
 	var b strings.Builder
 	b.WriteString("<ns:abResolveNames>")
 	b.WriteString("<ulSessionId>")
 	b.WriteString(sessionID.String())
 	b.WriteString("</ulSessionId>")
 	b.WriteString("<lpaPropTag SOAP-ENC:arrayType=\"xsd:unsignedInt[")
-	b.WriteString(strconv.FormatUint(uint64(len(props)), 64))
+	b.WriteString(strconv.FormatUint(uint64(len(props)), 10))
 	b.WriteString("]\">")
 	for _, prop := range props {
 		b.WriteString("<item>")
@@ -231,7 +300,7 @@ func (c *KCC) ABResolveNames(ctx context.Context, props []PT, request map[PT]int
 	}
 	b.WriteString("</lpaPropTag>")
 	b.WriteString("<lpsRowSet SOAP-ENC:arrayType=\"propVal[][")
-	b.WriteString(strconv.FormatUint(uint64(len(request)), 64))
+	b.WriteString(strconv.FormatUint(uint64(len(request)), 10))
 	b.WriteString("]\">")
 	for prop, value := range request {
 		b.WriteString("<item SOAP-ENC:arrayType=\"propVal[1]\">")
@@ -245,7 +314,7 @@ func (c *KCC) ABResolveNames(ctx context.Context, props []PT, request map[PT]int
 			b.WriteString(xmlCharData(tv).Escape())
 			b.WriteString("</lpszA>")
 		default:
-			return nil, fmt.Errorf("unsupported type in request map value: %v", value)
+			return "", fmt.Errorf("unsupported type in request map value: %v", value)
 		}
 		b.WriteString("</item>")
 		b.WriteString("</item>")
@@ -260,10 +329,6 @@ func (c *KCC) ABResolveNames(ctx context.Context, props []PT, request map[PT]int
 	b.WriteString(resolveNamesFlags.String())
 	b.WriteString("</ulFlags>")
 	b.WriteString("</ns:abResolveNames>")
-	payload := b.String()
-
-	var abResolveNamesResponse ABResolveNamesResponse
-	err := c.Client.DoRequest(ctx, &payload, &abResolveNamesResponse)
 
-	return &abResolveNamesResponse, err
+	return b.String(), nil
 }
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// ErrRequestQueueFull is the error returned by a LimitingSOAPClient when a
+// request is rejected because the maximum number of requests are in flight
+// and waiting already.
+var ErrRequestQueueFull = errors.New("soap request queue is full")
+
+// LimiterStats holds the current state of a LimitingSOAPClient.
+type LimiterStats struct {
+	MaxInFlight int
+	MaxQueue    int
+
+	// InFlight is the number of requests currently sent to the server.
+	InFlight int
+	// Queued is the number of requests currently waiting to be sent.
+	Queued int
+	// Rejected is the total number of requests rejected with
+	// ErrRequestQueueFull.
+	Rejected uint64
+}
+
+// A LimitingSOAPClient wraps a SOAPClient and limits the number of parallel
+// requests. Requests exceeding the limit wait in a bounded queue until a
+// request finished or their context is done. Requests exceeding the queue
+// are rejected with ErrRequestQueueFull.
+type LimitingSOAPClient struct {
+	Client SOAPClient
+
+	maxInFlight int
+	maxQueue    int
+
+	slots    chan struct{}
+	queued   int32
+	rejected uint64
+}
+
+// NewLimitingSOAPClient creates a new LimitingSOAPClient wrapping the provided
+// client, which allows maxInFlight parallel requests and maxQueue additional
+// waiting requests. A negative maxQueue allows an unlimited number of waiting
+// requests.
+func NewLimitingSOAPClient(client SOAPClient, maxInFlight, maxQueue int) (*LimitingSOAPClient, error) {
+	if maxInFlight <= 0 {
+		return nil, fmt.Errorf("invalid max in-flight requests: %d", maxInFlight)
+	}
+
+	return &LimitingSOAPClient{
+		Client: client,
+
+		maxInFlight: maxInFlight,
+		maxQueue:    maxQueue,
+
+		slots: make(chan struct{}, maxInFlight),
+	}, nil
+}
+
+// DoRequest sends the provided payload data as SOAP through the means of the
+// accociated client as soon as the number of requests in flight allows it.
+// Waiting is aborted with an error wrapping the context's error when the
+// provided context is done.
+func (lc *LimitingSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := lc.acquire(ctx); err != nil {
+		return err
+	}
+	defer lc.release()
+
+	return lc.Client.DoRequest(ctx, payload, v)
+}
+
+// DoStreamRequest sends the payload read from the provided reader as SOAP
+// through the means of the accociated client as soon as the number of
+// requests in flight allows it, and calls the provided decoder with the
+// response.
+func (lc *LimitingSOAPClient) DoStreamRequest(ctx context.Context, method string, payload io.Reader, decode SOAPResponseDecoder) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := lc.acquire(ctx); err != nil {
+		return err
+	}
+	defer lc.release()
+
+	return NewSOAPStreamClient(lc.Client).DoStreamRequest(ctx, method, payload, decode)
+}
+
+// Stats returns the current LimiterStats of the accociated client.
+func (lc *LimitingSOAPClient) Stats() LimiterStats {
+	return LimiterStats{
+		MaxInFlight: lc.maxInFlight,
+		MaxQueue:    lc.maxQueue,
+
+		InFlight: len(lc.slots),
+		Queued:   int(atomic.LoadInt32(&lc.queued)),
+		Rejected: atomic.LoadUint64(&lc.rejected),
+	}
+}
+
+// SetLogger sets the Logger of the accociated client, if supported.
+func (lc *LimitingSOAPClient) SetLogger(logger Logger) {
+	if setter, ok := lc.Client.(loggerSetter); ok {
+		setter.SetLogger(logger)
+	}
+}
+
+func (lc *LimitingSOAPClient) String() string {
+	return fmt.Sprintf("<limit:%d:%s>", lc.maxInFlight, lc.Client)
+}
+
+// acquire takes a slot for a request in flight, waiting in the queue if
+// needed.
+func (lc *LimitingSOAPClient) acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to wait for soap request slot: %w", err)
+	}
+
+	select {
+	case lc.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	queued := atomic.AddInt32(&lc.queued, 1)
+	defer atomic.AddInt32(&lc.queued, -1)
+	if lc.maxQueue >= 0 && int(queued) > lc.maxQueue {
+		atomic.AddUint64(&lc.rejected, 1)
+		return ErrRequestQueueFull
+	}
+
+	select {
+	case lc.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to wait for soap request slot: %w", ctx.Err())
+	}
+}
+
+// release returns a slot taken by acquire.
+func (lc *LimitingSOAPClient) release() {
+	<-lc.slots
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitForLimiterStats(t *testing.T, client *LimitingSOAPClient, inFlight, queued int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := client.Stats()
+		if stats.InFlight == inFlight && stats.Queued == queued {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected limiter stats: %+v", stats)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimitingSOAPClient(t *testing.T) {
+	unblock := make(chan struct{})
+	client, err := NewLimitingSOAPClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		<-unblock
+		return nil
+	}), 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := "<ns:getUser></ns:getUser>"
+	results := make(chan error, 3)
+	for idx := 0; idx < 3; idx++ {
+		go func() {
+			results <- client.DoRequest(context.Background(), &payload, &GetUserResponse{})
+		}()
+	}
+	waitForLimiterStats(t, client, 2, 1)
+
+	err = client.DoRequest(context.Background(), &payload, &GetUserResponse{})
+	if !errors.Is(err, ErrRequestQueueFull) {
+		t.Errorf("expected queue full error, got %v", err)
+	}
+	if stats := client.Stats(); stats.Rejected != 1 || stats.Queued != 1 {
+		t.Errorf("unexpected limiter stats after rejection: %+v", stats)
+	}
+
+	close(unblock)
+	for idx := 0; idx < 3; idx++ {
+		if err = <-results; err != nil {
+			t.Errorf("request failed: %v", err)
+		}
+	}
+	waitForLimiterStats(t, client, 0, 0)
+}
+
+func TestLimitingSOAPClientContext(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	client, err := NewLimitingSOAPClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		<-unblock
+		return nil
+	}), 1, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := "<ns:getUser></ns:getUser>"
+	go client.DoRequest(context.Background(), &payload, &GetUserResponse{})
+	waitForLimiterStats(t, client, 1, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = client.DoRequest(ctx, &payload, &GetUserResponse{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error, got %v", err)
+	}
+	if stats := client.Stats(); stats.Queued != 0 || stats.Rejected != 0 {
+		t.Errorf("unexpected limiter stats after timeout: %+v", stats)
+	}
+}
+
+func TestConfigConcurrencyLimit(t *testing.T) {
+	c, err := New(nil, WithConcurrencyLimit(4, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, ok := c.Client.(*LimitingSOAPClient)
+	if !ok {
+		t.Fatalf("unexpected client type: %T", c.Client)
+	}
+	if stats := client.Stats(); stats.MaxInFlight != 4 || stats.MaxQueue != 8 {
+		t.Errorf("unexpected limiter stats: %+v", stats)
+	}
+}
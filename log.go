@@ -0,0 +1,220 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LogLevel is the type representing the verbosity of log messages.
+type LogLevel int
+
+// Log levels, ordered by verbosity. At LogLevelInfo, SOAP requests are logged
+// with method name and timing only. At LogLevelDebug, the redacted SOAP
+// envelopes are logged as well.
+const (
+	LogLevelError LogLevel = iota
+	LogLevelWarn
+	LogLevelInfo
+	LogLevelDebug
+)
+
+var logLevelNameMap = map[LogLevel]string{
+	LogLevelError: "error",
+	LogLevelWarn:  "warn",
+	LogLevelInfo:  "info",
+	LogLevelDebug: "debug",
+}
+
+func (level LogLevel) String() string {
+	if name, ok := logLevelNameMap[level]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(level))
+}
+
+// A Logger receives structured log messages. The fields map is compatible
+// with logrus.Fields, so Logger can be easily implemented with logrus.
+type Logger interface {
+	// Enabled returns true if messages of the provided level are logged.
+	Enabled(level LogLevel) bool
+	// Log logs the provided message with fields.
+	Log(level LogLevel, msg string, fields map[string]interface{})
+}
+
+// DefaultLogger is the Logger used by SOAP clients without their own Logger.
+// It is nil unless the environment variable KCC_GO_DEBUG is set, in which case
+// it logs at LogLevelDebug to stdout.
+var DefaultLogger Logger = defaultLoggerFromEnv()
+
+func defaultLoggerFromEnv() Logger {
+	if os.Getenv("KCC_GO_DEBUG") == "" {
+		return nil
+	}
+	return NewWriterLogger(os.Stdout, LogLevelDebug)
+}
+
+// A writerLogger writes log messages as text lines to a writer.
+type writerLogger struct {
+	mutex sync.Mutex
+	w     io.Writer
+	level LogLevel
+}
+
+// NewWriterLogger creates a Logger which writes all messages up to the provided
+// level as "key=value" text lines to the provided writer.
+func NewWriterLogger(w io.Writer, level LogLevel) Logger {
+	return &writerLogger{
+		w:     w,
+		level: level,
+	}
+}
+
+func (wl *writerLogger) Enabled(level LogLevel) bool {
+	return level <= wl.level
+}
+
+func (wl *writerLogger) Log(level LogLevel, msg string, fields map[string]interface{}) {
+	if !wl.Enabled(level) {
+		return
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "level=%s msg=%q", level, msg)
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %s=%q", key, fmt.Sprint(fields[key]))
+	}
+	b.WriteByte('\n')
+
+	wl.mutex.Lock()
+	b.WriteTo(wl.w)
+	wl.mutex.Unlock()
+}
+
+// redactedElementsRegexp matches the start tags of elements whose values must
+// not be logged, that is passwords, SSO tokens and session IDs.
+var redactedElementsRegexp = regexp.MustCompile(`(<(?:[A-Za-z0-9]+:)?(?:szPassword|lpInput|ulSessionId)(?:\s[^>]*)?>)[^<]*`)
+
+// RedactSOAP returns a copy of the provided SOAP data with the values of
+// szPassword, lpInput and ulSessionId elements replaced.
+func RedactSOAP(data string) string {
+	return redactedElementsRegexp.ReplaceAllString(data, "${1}[redacted]")
+}
+
+// logSOAPRequest logs the redacted SOAP envelope of the provided payload.
+func logSOAPRequest(logger Logger, payload *string) {
+	if logger == nil || !logger.Enabled(LogLevelDebug) || payload == nil {
+		return
+	}
+
+	logger.Log(LogLevelDebug, "SOAP request", map[string]interface{}{
+		"method":   soapMethodName(payload),
+		"envelope": RedactSOAP(soapHeader + *payload + soapFooter),
+	})
+}
+
+// logSOAPStreamRequest logs the method of a SOAP request with a streamed
+// payload, which is not available for logging.
+func logSOAPStreamRequest(logger Logger, method string) {
+	if logger == nil || !logger.Enabled(LogLevelDebug) {
+		return
+	}
+
+	logger.Log(LogLevelDebug, "SOAP request", map[string]interface{}{
+		"method": method,
+	})
+}
+
+// logSOAPResponse logs the redacted SOAP response read from the provided data
+// and returns a reader which provides the same data again.
+func logSOAPResponse(logger Logger, method string, code int, data io.Reader) (io.Reader, error) {
+	if logger == nil || !logger.Enabled(LogLevelDebug) {
+		return data, nil
+	}
+
+	raw, err := ioutil.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log(LogLevelDebug, "SOAP response", map[string]interface{}{
+		"method":   method,
+		"status":   code,
+		"envelope": RedactSOAP(string(raw)),
+	})
+
+	return bytes.NewReader(raw), nil
+}
+
+// logSOAPDone logs method name and timing of a completed SOAP request.
+func logSOAPDone(logger Logger, method string, started time.Time, err error) {
+	if logger == nil {
+		return
+	}
+
+	fields := map[string]interface{}{
+		"method":   method,
+		"duration": time.Since(started),
+	}
+	if err != nil {
+		fields["error"] = RedactSOAP(err.Error())
+		if logger.Enabled(LogLevelWarn) {
+			logger.Log(LogLevelWarn, "SOAP request failed", fields)
+		}
+		return
+	}
+	if logger.Enabled(LogLevelInfo) {
+		logger.Log(LogLevelInfo, "SOAP request done", fields)
+	}
+}
+
+// soapClientLogger returns the provided logger or the DefaultLogger if nil.
+func soapClientLogger(logger Logger) Logger {
+	if logger != nil {
+		return logger
+	}
+	return DefaultLogger
+}
+
+// A loggerSetter is a SOAPClient which can be configured with a Logger.
+type loggerSetter interface {
+	SetLogger(logger Logger)
+}
+
+// SetLogger sets the Logger of the accociated KCC's client. It returns false if
+// the client does not support logging.
+func (c *KCC) SetLogger(logger Logger) bool {
+	if setter, ok := c.Client.(loggerSetter); ok {
+		setter.SetLogger(logger)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedactSOAP(t *testing.T) {
+	for _, tc := range []struct {
+		data     string
+		expected string
+	}{
+		{
+			"<ns:logon><szUsername>user1</szUsername><szPassword>secret</szPassword></ns:logon>",
+			"<ns:logon><szUsername>user1</szUsername><szPassword>[redacted]</szPassword></ns:logon>",
+		},
+		{
+			"<ns:ssoLogon><lpInput>S09JREM6dG9rZW4=</lpInput><ulSessionId>1234</ulSessionId></ns:ssoLogon>",
+			"<ns:ssoLogon><lpInput>[redacted]</lpInput><ulSessionId>[redacted]</ulSessionId></ns:ssoLogon>",
+		},
+		{
+			`<ns:logonResponse><er>0</er><ns:ulSessionId xsi:type="xsd:unsignedLong">1234</ns:ulSessionId></ns:logonResponse>`,
+			`<ns:logonResponse><er>0</er><ns:ulSessionId xsi:type="xsd:unsignedLong">[redacted]</ns:ulSessionId></ns:logonResponse>`,
+		},
+	} {
+		if redacted := RedactSOAP(tc.data); redacted != tc.expected {
+			t.Errorf("unexpected redaction result, got %s, expected %s", redacted, tc.expected)
+		}
+	}
+}
+
+func TestSOAPClientLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(rw, testSOAPResponse("<ns:logonResponse><er>0</er><ulSessionId>1234</ulSessionId></ns:logonResponse>"))
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewKCCWithClient(client)
+
+	for _, level := range []LogLevel{LogLevelInfo, LogLevelDebug} {
+		var b bytes.Buffer
+		if !c.SetLogger(NewWriterLogger(&b, level)) {
+			t.Fatal("client does not support logging")
+		}
+		if _, err = c.Logon(context.Background(), "user1", "secret", 0); err != nil {
+			t.Fatal(err)
+		}
+
+		logged := b.String()
+		if strings.Contains(logged, "secret") || strings.Contains(logged, "1234") {
+			t.Errorf("secret logged at level %v: %s", level, logged)
+		}
+		if !strings.Contains(logged, `method="logon"`) || !strings.Contains(logged, "duration=") {
+			t.Errorf("method or timing not logged at level %v: %s", level, logged)
+		}
+		if hasEnvelope := strings.Contains(logged, "envelope="); hasEnvelope != (level == LogLevelDebug) {
+			t.Errorf("unexpected envelope logging at level %v: %s", level, logged)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metrics provides optional Prometheus instrumentation for kcc-go
+// SOAP clients and sessions.
+package metrics // import "stash.kopano.io/kgol/kcc-go/v5/metrics"
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"stash.kopano.io/kgol/kcc-go/v5"
+)
+
+const namespace = "kcc"
+
+// Metrics holds the Prometheus collectors for kcc-go instrumentation.
+type Metrics struct {
+	soapRequests        *prometheus.CounterVec
+	soapRequestErrors   *prometheus.CounterVec
+	soapRequestDuration *prometheus.HistogramVec
+	soapKCErrors        *prometheus.CounterVec
+
+	unixPoolWait *prometheus.HistogramVec
+	unixPoolSize *prometheus.GaugeVec
+	unixConns    *prometheus.CounterVec
+
+	sessionsActive    prometheus.Gauge
+	sessionsExpired   prometheus.Counter
+	sessionsRefreshed prometheus.Counter
+}
+
+// New creates Metrics and registers all its collectors with the provided
+// registerer.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		soapRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "soap",
+			Name:      "requests_total",
+			Help:      "Total number of SOAP requests.",
+		}, []string{"method", "transport"}),
+		soapRequestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "soap",
+			Name:      "request_errors_total",
+			Help:      "Total number of SOAP requests which failed without response.",
+		}, []string{"method", "transport"}),
+		soapRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "soap",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of SOAP requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "transport"}),
+		soapKCErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "soap",
+			Name:      "kcerrors_total",
+			Help:      "Total number of KCErrors returned by SOAP requests.",
+		}, []string{"method", "code"}),
+
+		unixPoolWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "unix",
+			Name:      "pool_wait_seconds",
+			Help:      "Duration waited for a pooled unix socket connection.",
+			Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5, 10},
+		}, []string{"path"}),
+		unixPoolSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "unix",
+			Name:      "pool_connections",
+			Help:      "Number of open unix socket connections.",
+		}, []string{"path"}),
+		unixConns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "unix",
+			Name:      "connections_total",
+			Help:      "Total number of unix socket connections used by requests.",
+		}, []string{"path", "reused"}),
+
+		sessionsActive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "session",
+			Name:      "active",
+			Help:      "Number of active sessions.",
+		}),
+		sessionsExpired: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "session",
+			Name:      "expired_total",
+			Help:      "Total number of sessions which failed to refresh.",
+		}),
+		sessionsRefreshed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "session",
+			Name:      "refreshed_total",
+			Help:      "Total number of successful session refreshes.",
+		}),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		m.soapRequests,
+		m.soapRequestErrors,
+		m.soapRequestDuration,
+		m.soapKCErrors,
+		m.unixPoolWait,
+		m.unixPoolSize,
+		m.unixConns,
+		m.sessionsActive,
+		m.sessionsExpired,
+		m.sessionsRefreshed,
+	} {
+		if err := reg.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Interceptor returns a kcc.SOAPInterceptor which records request metrics with
+// the provided transport label.
+func (m *Metrics) Interceptor(transport string) kcc.SOAPInterceptor {
+	return func(ctx context.Context, call *kcc.SOAPCall, payload *string, v interface{}, invoker kcc.SOAPInvoker) error {
+		err := invoker(ctx, payload, v)
+
+		m.soapRequests.WithLabelValues(call.Method, transport).Inc()
+		m.soapRequestDuration.WithLabelValues(call.Method, transport).Observe(call.Duration.Seconds())
+		if err != nil {
+			m.soapRequestErrors.WithLabelValues(call.Method, transport).Inc()
+		} else if call.Er != kcc.KCSuccess {
+			m.soapKCErrors.WithLabelValues(call.Method, kcErrorLabel(call.Er)).Inc()
+		}
+
+		return err
+	}
+}
+
+// InstrumentSOAPClient returns a kcc.SOAPClient which records metrics for all
+// requests of the provided client. Connection pool metrics are recorded as
+// well, if the provided client is a kcc.SOAPSocketClient.
+func (m *Metrics) InstrumentSOAPClient(client kcc.SOAPClient) kcc.SOAPClient {
+	transport := "other"
+	switch c := client.(type) {
+	case *kcc.SOAPHTTPClient:
+		transport = "http"
+	case *kcc.SOAPSocketClient:
+		transport = "unix"
+		m.instrumentSocketClient(c)
+	}
+
+	return kcc.ChainSOAPClient(client, m.Interceptor(transport))
+}
+
+func (m *Metrics) instrumentSocketClient(c *kcc.SOAPSocketClient) {
+	poolWait := m.unixPoolWait.WithLabelValues(c.Path)
+	poolSize := m.unixPoolSize.WithLabelValues(c.Path)
+	c.OnPoolWait = func(d time.Duration) {
+		poolWait.Observe(d.Seconds())
+		poolSize.Set(float64(c.PoolSize()))
+	}
+	connsNew := m.unixConns.WithLabelValues(c.Path, "false")
+	connsReused := m.unixConns.WithLabelValues(c.Path, "true")
+	c.OnConnReuse = func(reused bool) {
+		if reused {
+			connsReused.Inc()
+		} else {
+			connsNew.Inc()
+		}
+	}
+}
+
+// InstrumentKCC instruments the provided kcc.KCC, its client and all sessions
+// created with it. A SessionEventHandler already set on the provided kcc.KCC
+// is still called for all session events.
+func (m *Metrics) InstrumentKCC(c *kcc.KCC) {
+	c.Client = m.InstrumentSOAPClient(c.Client)
+	handler := c.SessionEventHandler
+	c.SessionEventHandler = func(session *kcc.Session, event kcc.SessionEvent) {
+		m.HandleSessionEvent(session, event)
+		if handler != nil {
+			handler(session, event)
+		}
+	}
+}
+
+// HandleSessionEvent records session metrics for the provided event. It is
+// suitable to be used as kcc.KCC.SessionEventHandler.
+func (m *Metrics) HandleSessionEvent(session *kcc.Session, event kcc.SessionEvent) {
+	switch event {
+	case kcc.SessionEventCreated:
+		m.sessionsActive.Inc()
+	case kcc.SessionEventRefreshed:
+		m.sessionsRefreshed.Inc()
+	case kcc.SessionEventExpired:
+		m.sessionsExpired.Inc()
+	case kcc.SessionEventDestroyed:
+		m.sessionsActive.Dec()
+	}
+}
+
+func kcErrorLabel(er kcc.KCError) string {
+	if name, ok := kcc.KCErrorNameMap[er]; ok {
+		return strings.TrimSuffix(name, ":")
+	}
+	return "0x" + strconv.FormatUint(uint64(er), 16)
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"stash.kopano.io/kgol/kcc-go/v5"
+)
+
+type testSOAPClient func(ctx context.Context, payload *string, v interface{}) error
+
+func (tc testSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	return tc(ctx, payload, v)
+}
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := kcc.NewKCCWithClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		switch response := v.(type) {
+		case *kcc.LogonResponse:
+			response.SessionID = 1
+			response.ServerGUID = "test"
+		case *kcc.ResolveUserResponse:
+			response.Er = kcc.KCERR_NO_ACCESS
+		}
+		return nil
+	}))
+	m.InstrumentKCC(c)
+
+	session, err := kcc.NewSession(context.Background(), c, "user1", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.ResolveUsername(context.Background(), "nobody", session.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := testutil.ToFloat64(m.sessionsActive); v != 1 {
+		t.Errorf("unexpected active sessions value: %v", v)
+	}
+	if v := testutil.ToFloat64(m.soapRequests.WithLabelValues("logon", "other")); v != 1 {
+		t.Errorf("unexpected logon requests value: %v", v)
+	}
+	if v := testutil.ToFloat64(m.soapKCErrors.WithLabelValues("resolveUsername", "KCERR_NO_ACCESS")); v != 1 {
+		t.Errorf("unexpected kcerrors value: %v", v)
+	}
+
+	if err = session.Destroy(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if v := testutil.ToFloat64(m.sessionsActive); v != 0 {
+		t.Errorf("unexpected active sessions value after destroy: %v", v)
+	}
+}
+
+func TestMetricsSessionEventHandler(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []kcc.SessionEvent
+	c := kcc.NewKCCWithClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		return nil
+	}))
+	c.SessionEventHandler = func(session *kcc.Session, event kcc.SessionEvent) {
+		events = append(events, event)
+	}
+	m.InstrumentKCC(c)
+
+	session, err := kcc.CreateSession(context.Background(), c, 1, "test", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = session.Destroy(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0] != kcc.SessionEventCreated || events[1] != kcc.SessionEventDestroyed {
+		t.Errorf("existing session event handler was not called: %v", events)
+	}
+}
+
+func TestKCErrorLabel(t *testing.T) {
+	for er, expected := range map[kcc.KCError]string{
+		kcc.KCERR_NOT_FOUND: "KCERR_NOT_FOUND",
+		kcc.KCERR_NO_ACCESS: "KCERR_NO_ACCESS",
+		0x12345:             "0x12345",
+	} {
+		if label := kcErrorLabel(er); label != expected {
+			t.Errorf("unexpected label for %v: %s", expected, label)
+		}
+	}
+}
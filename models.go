@@ -16,6 +16,11 @@
 
 package kcc
 
+import (
+	"encoding/xml"
+	"fmt"
+)
+
 // A LogonResponse holds tthe returned data of a SOAP logon request.
 type LogonResponse struct {
 	Er         KCError     `xml:"er" json:"-"`
@@ -51,6 +56,31 @@ type ABResolveNamesResponse struct {
 	Flags  []ABFlag         `xml:"aFlags>item"`
 }
 
+// ABResolveNamesStreamResponse holds the returned data of a SOAP request which
+// resolves names, with the rows passed to the handler of RowSet while the
+// response is decoded.
+type ABResolveNamesStreamResponse struct {
+	Er     KCError             `xml:"er"`
+	RowSet PropTagRowSetStream `xml:"sRowSet"`
+	Flags  []ABFlag            `xml:"aFlags>item"`
+}
+
+// responseDelivered returns true if rows were passed to the row handler, so
+// the request must not be retried.
+func (r *ABResolveNamesStreamResponse) responseDelivered() bool {
+	return r.RowSet.Count > 0
+}
+
+// resetResponse resets the accociated response for reuse, keeping the row
+// handler.
+func (r *ABResolveNamesStreamResponse) resetResponse() {
+	*r = ABResolveNamesStreamResponse{
+		RowSet: PropTagRowSetStream{
+			Handler: r.RowSet.Handler,
+		},
+	}
+}
+
 // A User represents the meta data of a user as stored by Kopano server.
 type User struct {
 	ID          uint64     `xml:"ulUserId" json:"ulUserID"`
@@ -119,3 +149,47 @@ type PropTagRowSetValue struct {
 	BinValue     []byte     `xml:"bin" json:"bin,omitempty"`
 	BinValues    [][][]byte `xml:"mvbin>item" json:"mvbin,omitempty"`
 }
+
+// A PropTagRowSetStream decodes the rows of a row set one at a time and passes
+// each row to its Handler, so large tables are never held in memory as a
+// whole. Count is the number of rows passed to the Handler.
+type PropTagRowSetStream struct {
+	Handler func(row *PropTagRowSet) error `xml:"-" json:"-"`
+	Count   int                            `xml:"-" json:"count"`
+}
+
+// UnmarshalXML implements the xml.Unmarshaler interface, calling the Handler
+// of the accociated PropTagRowSetStream for each item of the row set.
+func (s *PropTagRowSetStream) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if s.Handler == nil {
+		return fmt.Errorf("no handler for row set stream")
+	}
+
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch se := t.(type) {
+		case xml.StartElement:
+			if se.Name.Local != "item" {
+				if err = d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			var row PropTagRowSet
+			if err = d.DecodeElement(&row, &se); err != nil {
+				return err
+			}
+			s.Count++
+			if err = s.Handler(&row); err != nil {
+				return err
+			}
+
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A RetryPolicy defines if and when failed SOAP requests are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait duration before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff limits the wait duration between retries.
+	MaxBackoff time.Duration
+	// Multiplier is applied to the wait duration after each retry.
+	Multiplier float64
+	// Jitter is the fraction (0 to 1) by which wait durations are randomized.
+	Jitter float64
+
+	// RetryableErrors lists the KCErrors which are retried when returned by
+	// the server.
+	RetryableErrors []KCError
+	// NonIdempotentMethods lists the SOAP methods which must not be sent
+	// twice. Those are only retried when the request was never sent.
+	NonIdempotentMethods []string
+
+	// Budget optionally limits the ratio of retries to requests.
+	Budget *RetryBudget
+}
+
+// DefaultRetryPolicy is the RetryPolicy used when constructing a
+// RetryingSOAPClient without policy.
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     1 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+
+	RetryableErrors: []KCError{
+		KCERR_NETWORK_ERROR,
+		KCERR_SERVER_NOT_RESPONDING,
+		KCERR_TIMEOUT,
+		KCERR_BUSY,
+	},
+	NonIdempotentMethods: []string{
+		"logon",
+		"ssoLogon",
+	},
+}
+
+// backoff returns the wait duration before the provided retry (starting at 1).
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(d)
+}
+
+func (p *RetryPolicy) isRetryableKCError(er KCError) bool {
+	for _, retryable := range p.RetryableErrors {
+		if er == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) isIdempotent(method string) bool {
+	for _, nonIdempotent := range p.NonIdempotentMethods {
+		if method == nonIdempotent {
+			return false
+		}
+	}
+	return true
+}
+
+// A RetryBudget limits retries to a ratio of successful requests, so retries
+// cannot multiply load on an already failing server. Every failed attempt
+// takes a token, every successful request returns tokenRatio tokens. Retries
+// are allowed as long as more than half of maxTokens are available.
+type RetryBudget struct {
+	mutex      sync.Mutex
+	tokens     float64
+	maxTokens  float64
+	tokenRatio float64
+}
+
+// NewRetryBudget creates a new RetryBudget with the provided parameters.
+func NewRetryBudget(maxTokens, tokenRatio float64) *RetryBudget {
+	return &RetryBudget{
+		tokens:     maxTokens,
+		maxTokens:  maxTokens,
+		tokenRatio: tokenRatio,
+	}
+}
+
+func (b *RetryBudget) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.tokens > b.maxTokens/2
+}
+
+func (b *RetryBudget) onFailure() {
+	b.mutex.Lock()
+	b.tokens = math.Max(0, b.tokens-1)
+	b.mutex.Unlock()
+}
+
+func (b *RetryBudget) onSuccess() {
+	b.mutex.Lock()
+	b.tokens = math.Min(b.maxTokens, b.tokens+b.tokenRatio)
+	b.mutex.Unlock()
+}
+
+// A RetryingSOAPClient wraps a SOAPClient and retries failed requests
+// according to its RetryPolicy.
+type RetryingSOAPClient struct {
+	Client SOAPClient
+	Policy *RetryPolicy
+}
+
+// NewRetryingSOAPClient creates a new RetryingSOAPClient wrapping the provided
+// client. If policy is nil, the DefaultRetryPolicy is used.
+func NewRetryingSOAPClient(client SOAPClient, policy *RetryPolicy) *RetryingSOAPClient {
+	if policy == nil {
+		policy = DefaultRetryPolicy
+	}
+
+	return &RetryingSOAPClient{
+		Client: client,
+		Policy: policy,
+	}
+}
+
+// DoRequest sends the provided payload data as SOAP through the means of the
+// accociated client, retrying transport errors and retryable KCErrors. When
+// all attempts failed, the last result is returned.
+func (rc *RetryingSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	policy := rc.Policy
+	idempotent := policy.isIdempotent(soapMethodName(payload))
+
+	return rc.retry(ctx, func(ctx context.Context, attempt int) (bool, error) {
+		if attempt > 1 {
+			resetResponse(v)
+		}
+
+		err := rc.Client.DoRequest(ctx, payload, v)
+
+		var retryable bool
+		if err != nil {
+			if idempotent {
+				retryable = isRetryableTransportError(err)
+			} else {
+				retryable = isDialError(err)
+			}
+		} else if er := responseKCError(v); er != KCSuccess {
+			retryable = idempotent && policy.isRetryableKCError(er)
+		}
+		if retryable && isResponseDelivered(v) {
+			// Streamed data must not be delivered twice.
+			retryable = false
+		}
+
+		return retryable, err
+	})
+}
+
+// DoStreamRequest sends the payload read from the provided reader as SOAP
+// through the means of the accociated client and calls the provided decoder
+// with the response. Since the payload cannot be read again, only transport
+// errors which occurred before any of the payload was read are retried.
+func (rc *RetryingSOAPClient) DoStreamRequest(ctx context.Context, method string, payload io.Reader, decode SOAPResponseDecoder) error {
+	client := NewSOAPStreamClient(rc.Client)
+	tracked := &readTrackingReader{r: payload}
+
+	return rc.retry(ctx, func(ctx context.Context, attempt int) (bool, error) {
+		err := client.DoStreamRequest(ctx, method, tracked, decode)
+
+		return err != nil && !tracked.wasRead() && isRetryableTransportError(err), err
+	})
+}
+
+// retry calls the provided function for every attempt until it returns a
+// result which is not retryable or the accociated policy allows no further
+// attempts, and returns the last error.
+func (rc *RetryingSOAPClient) retry(ctx context.Context, do func(ctx context.Context, attempt int) (bool, error)) error {
+	policy := rc.Policy
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for attempt := 1; ; attempt++ {
+		retryable, err := do(ctx, attempt)
+
+		if policy.Budget != nil {
+			if retryable {
+				policy.Budget.onFailure()
+			} else if err == nil {
+				policy.Budget.onSuccess()
+			}
+		}
+		if !retryable || attempt >= policy.MaxAttempts {
+			return err
+		}
+		if policy.Budget != nil && !policy.Budget.allow() {
+			return err
+		}
+
+		select {
+		case <-time.After(policy.backoff(attempt)):
+			// Retry now.
+		case <-ctx.Done():
+			// Abort with last result.
+			return err
+		}
+	}
+}
+
+// SetLogger sets the Logger of the accociated client, if supported.
+func (rc *RetryingSOAPClient) SetLogger(logger Logger) {
+	if setter, ok := rc.Client.(loggerSetter); ok {
+		setter.SetLogger(logger)
+	}
+}
+
+func (rc *RetryingSOAPClient) String() string {
+	return fmt.Sprintf("<retry:%s>", rc.Client)
+}
+
+// isRetryableTransportError returns true for errors which signal that the
+// connection to the server failed, but retrying might succeed.
+func isRetryableTransportError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if isDialError(err) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	return IsTemporary(err)
+}
+
+// isDialError returns true for errors which signal that no connection could
+// be established, thus no request was sent to the server.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testSOAPClient func(ctx context.Context, payload *string, v interface{}) error
+
+func (tc testSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	return tc(ctx, payload, v)
+}
+
+var testRetryPolicy = &RetryPolicy{
+	MaxAttempts:     3,
+	InitialBackoff:  time.Millisecond,
+	Multiplier:      2,
+	RetryableErrors: DefaultRetryPolicy.RetryableErrors,
+	NonIdempotentMethods: []string{
+		"logon",
+	},
+}
+
+func TestRetryingSOAPClientKCError(t *testing.T) {
+	attempts := 0
+	client := NewRetryingSOAPClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		attempts++
+		response := v.(*ResolveUserResponse)
+		if response.Er != KCSuccess {
+			t.Errorf("response was not reset before retry")
+		}
+		if attempts < 3 {
+			response.Er = KCERR_BUSY
+		} else {
+			response.ID = 2
+		}
+		return nil
+	}), testRetryPolicy)
+
+	payload := "<ns:resolveUsername></ns:resolveUsername>"
+	var response ResolveUserResponse
+	err := client.DoRequest(context.Background(), &payload, &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 || response.Er != KCSuccess || response.ID != 2 {
+		t.Errorf("unexpected result after %d attempts: %+v", attempts, response)
+	}
+}
+
+func TestRetryingSOAPClientGivesUp(t *testing.T) {
+	attempts := 0
+	client := NewRetryingSOAPClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		attempts++
+		return io.ErrUnexpectedEOF
+	}), testRetryPolicy)
+
+	payload := "<ns:getUser></ns:getUser>"
+	err := client.DoRequest(context.Background(), &payload, &GetUserResponse{})
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if attempts != testRetryPolicy.MaxAttempts {
+		t.Errorf("unexpected number of attempts: %d", attempts)
+	}
+}
+
+func TestRetryingSOAPClientNonIdempotent(t *testing.T) {
+	attempts := 0
+	client := NewRetryingSOAPClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		attempts++
+		v.(*LogonResponse).Er = KCERR_BUSY
+		return io.ErrUnexpectedEOF
+	}), testRetryPolicy)
+
+	payload := "<ns:logon><szUsername>user1</szUsername></ns:logon>"
+	_ = client.DoRequest(context.Background(), &payload, &LogonResponse{})
+	if attempts != 1 {
+		t.Errorf("non-idempotent method was retried %d times", attempts-1)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := NewRetryBudget(4, 0.5)
+	for i := 0; i < 2; i++ {
+		if !budget.allow() {
+			t.Fatalf("retry budget exhausted after %d failures", i)
+		}
+		budget.onFailure()
+	}
+	if budget.allow() {
+		t.Error("retry budget allowed retry while exhausted")
+	}
+	budget.onSuccess()
+	if !budget.allow() {
+		t.Error("retry budget did not recover after success")
+	}
+}
+
+func TestRetryingSOAPClientDeliveredStream(t *testing.T) {
+	attempts := 0
+	rows := 2
+	client := NewRetryingSOAPClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		attempts++
+		var b strings.Builder
+		b.WriteString("<ns:abResolveNamesResponse><er>0</er><sRowSet>")
+		for i := 0; i < rows; i++ {
+			fmt.Fprintf(&b, "<item><item><ulPropTag>%d</ulPropTag><lpszA>user%d</lpszA></item></item>", PR_ACCOUNT_A, i)
+		}
+		b.WriteString("</sRowSet></ns:abResolveNamesResponse>")
+		if err := parseSOAPResponse(http.StatusOK, strings.NewReader(testSOAPResponse(b.String())), v, newResponseLimits(0, 0)); err != nil {
+			return err
+		}
+		return io.ErrUnexpectedEOF
+	}), testRetryPolicy)
+	c := NewKCCWithClient(client)
+
+	handled := 0
+	handler := func(row *PropTagRowSet) error {
+		handled++
+		return nil
+	}
+	_, err := c.ABResolveNamesStream(context.Background(), []PT{PR_ACCOUNT_A}, map[PT]interface{}{PR_ACCOUNT_A: "user"}, 0, 1, 0, handler)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if attempts != 1 || handled != 2 {
+		t.Errorf("delivered stream was retried: %d attempts, %d rows handled", attempts, handled)
+	}
+
+	// Without delivered rows, the request is retried as usual.
+	attempts, handled, rows = 0, 0, 0
+	_, err = c.ABResolveNamesStream(context.Background(), []PT{PR_ACCOUNT_A}, map[PT]interface{}{PR_ACCOUNT_A: "user"}, 0, 1, 0, handler)
+	if err != io.ErrUnexpectedEOF || attempts != testRetryPolicy.MaxAttempts {
+		t.Errorf("empty stream was not retried: %v after %d attempts", err, attempts)
+	}
+}
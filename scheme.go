@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DefaultUnixSocketPath is the path of the Kopano server Unix socket which is
+// used for the "default:" URI.
+var DefaultUnixSocketPath = "/var/run/kopano/server.sock"
+
+// A SOAPSchemeFactory creates a SOAPClient for the provided URL using the
+// provided config.
+type SOAPSchemeFactory func(uri *url.URL, config *SOAPClientConfig) (SOAPClient, error)
+
+var soapSchemes = struct {
+	sync.RWMutex
+	factories map[string]SOAPSchemeFactory
+}{
+	factories: map[string]SOAPSchemeFactory{
+		"http":      newSOAPHTTPClientWithConfig,
+		"https":     newSOAPHTTPClientWithConfig,
+		"file":      newSOAPSocketClientWithConfig,
+		"unix":      newSOAPSocketClientWithConfig,
+		"http+unix": newSOAPSocketClientWithConfig,
+		"default":   newSOAPSocketClientWithConfig,
+	},
+}
+
+// RegisterSOAPScheme registers the provided factory to create SOAP clients for
+// URLs with the provided scheme, replacing any factory previously registered
+// for that scheme. Registering a nil factory removes the scheme.
+func RegisterSOAPScheme(scheme string, factory SOAPSchemeFactory) {
+	scheme = strings.ToLower(scheme)
+
+	soapSchemes.Lock()
+	defer soapSchemes.Unlock()
+
+	if factory == nil {
+		delete(soapSchemes.factories, scheme)
+		return
+	}
+	soapSchemes.factories[scheme] = factory
+}
+
+// LookupSOAPScheme returns the factory registered for the provided scheme.
+func LookupSOAPScheme(scheme string) (SOAPSchemeFactory, bool) {
+	soapSchemes.RLock()
+	defer soapSchemes.RUnlock()
+
+	factory, ok := soapSchemes.factories[strings.ToLower(scheme)]
+	return factory, ok
+}
+
+func newSOAPHTTPClientWithConfig(uri *url.URL, config *SOAPClientConfig) (SOAPClient, error) {
+	httpClient, err := config.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewSOAPHTTPClient(uri, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	c.MaxResponseSize = config.MaxResponseSize
+	c.MaxResponseDepth = config.MaxResponseDepth
+	c.Compression = config.Compression
+
+	return c, nil
+}
+
+func newSOAPSocketClientWithConfig(uri *url.URL, config *SOAPClientConfig) (SOAPClient, error) {
+	c, err := newSOAPSocketClient(uri, config.SocketDialer, config.UnixMaxConnections)
+	if err != nil {
+		return nil, err
+	}
+	if config.UnixIdleConnTimeout > 0 {
+		c.Transport.IdleConnTimeout = config.UnixIdleConnTimeout
+	}
+	c.MaxResponseSize = config.MaxResponseSize
+	c.MaxResponseDepth = config.MaxResponseDepth
+	c.Compression = config.Compression
+
+	return c, nil
+}
+
+// unixSocketPath returns the Unix socket path for the provided URL. Supported
+// are file:///path, unix:///path, http+unix:///path, default: which resolves
+// to DefaultUnixSocketPath and unix:@name for Linux abstract sockets. The host
+// of file and http+unix URLs is ignored.
+func unixSocketPath(uri *url.URL) (string, error) {
+	var path string
+
+	switch strings.ToLower(uri.Scheme) {
+	case "file", "http+unix":
+		path = uri.Path
+	case "unix":
+		if uri.Opaque != "" {
+			path = uri.Opaque
+		} else {
+			path = uri.Path
+		}
+	case "default":
+		path = DefaultUnixSocketPath
+	default:
+		return "", fmt.Errorf("invalid scheme '%v' for SOAP socket client", uri.Scheme)
+	}
+
+	if path == "" {
+		return "", fmt.Errorf("missing socket path in '%v' URI", uri.Scheme)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestSOAPSchemeSocketPaths(t *testing.T) {
+	for _, tc := range []struct {
+		uri  string
+		path string
+	}{
+		{"file:///run/kopano/server.sock", "/run/kopano/server.sock"},
+		{"unix:///run/kopano/server.sock", "/run/kopano/server.sock"},
+		{"unix:/run/kopano/server.sock", "/run/kopano/server.sock"},
+		{"unix:@kopano-server", "@kopano-server"},
+		{"http+unix:///run/kopano/server.sock", "/run/kopano/server.sock"},
+		{"http+unix://localhost/run/kopano/server.sock", "/run/kopano/server.sock"},
+		{"default:", DefaultUnixSocketPath},
+	} {
+		uri, err := url.Parse(tc.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := NewSOAPClient(uri)
+		if err != nil {
+			t.Errorf("failed to create client for %v: %v", tc.uri, err)
+			continue
+		}
+		sc, ok := client.(*SOAPSocketClient)
+		if !ok {
+			t.Errorf("unexpected client type for %v: %T", tc.uri, client)
+			continue
+		}
+		if sc.Path != tc.path {
+			t.Errorf("unexpected path for %v: %v", tc.uri, sc.Path)
+		}
+	}
+
+	if _, err := NewSOAPClient(&url.URL{Scheme: "unix"}); err == nil {
+		t.Errorf("expected error for unix URI without path")
+	}
+	if _, err := NewSOAPClient(&url.URL{Scheme: "ftp", Host: "localhost"}); err == nil {
+		t.Errorf("expected error for unregistered scheme")
+	}
+}
+
+func TestRegisterSOAPScheme(t *testing.T) {
+	var called *url.URL
+	RegisterSOAPScheme("Test+Tunnel", func(uri *url.URL, config *SOAPClientConfig) (SOAPClient, error) {
+		called = uri
+		return NewSOAPHTTPClient(&url.URL{Scheme: "http", Host: uri.Host}, config.HTTPClient)
+	})
+	defer RegisterSOAPScheme("test+tunnel", nil)
+
+	uri, _ := url.Parse("test+tunnel://localhost:2236")
+	client, err := NewSOAPClientWithConfig(uri, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if called != uri {
+		t.Errorf("registered factory was not called")
+	}
+	if sc, ok := client.(*SOAPHTTPClient); !ok || sc.URI != "http://localhost:2236" {
+		t.Errorf("unexpected client: %v", client)
+	}
+
+	if _, ok := LookupSOAPScheme("TEST+tunnel"); !ok {
+		t.Errorf("registered scheme was not found")
+	}
+
+	RegisterSOAPScheme("test+tunnel", nil)
+	if _, ok := LookupSOAPScheme("test+tunnel"); ok {
+		t.Errorf("removed scheme was found")
+	}
+	if _, err = NewSOAPClient(uri); err == nil {
+		t.Errorf("expected error for removed scheme")
+	}
+}
+
+func TestSOAPSocketClientAbstractSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract unix sockets are only supported on Linux")
+	}
+
+	name := fmt.Sprintf("@kcc-go-test-%d", os.Getpid())
+	listener, err := net.Listen("unix", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		fmt.Fprint(rw, soapHeader+`<ns:resolveUsernameResponse><er>0</er><ulUserId>3</ulUserId></ns:resolveUsernameResponse>`+soapFooter)
+	})}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	uri, _ := url.Parse("unix:" + name)
+	client, err := NewSOAPClient(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := NewKCCWithClient(client).ResolveUsername(context.Background(), "user1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != 3 {
+		t.Errorf("unexpected response: %v", resp)
+	}
+}
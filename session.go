@@ -43,6 +43,32 @@ func (sid KCSessionID) String() string {
 // KCNoSessionID define the value to use for KCSessionID when there is no session.
 const KCNoSessionID KCSessionID = 0
 
+// SessionEvent is the type of Session lifecycle events.
+type SessionEvent int
+
+// Session lifecycle events as passed to KCC.SessionEventHandler.
+const (
+	SessionEventCreated SessionEvent = iota
+	SessionEventRefreshed
+	SessionEventExpired
+	SessionEventDestroyed
+)
+
+func (ev SessionEvent) String() string {
+	switch ev {
+	case SessionEventCreated:
+		return "created"
+	case SessionEventRefreshed:
+		return "refreshed"
+	case SessionEventExpired:
+		return "expired"
+	case SessionEventDestroyed:
+		return "destroyed"
+	default:
+		return "unknown"
+	}
+}
+
 // Session holds the data structures to keep a session open on the accociated
 // Kopano server.
 type Session struct {
@@ -71,10 +97,10 @@ func NewSession(ctx context.Context, c *KCC, username, password string) (*Sessio
 
 	resp, err := c.Logon(ctx, username, password, 0)
 	if err != nil {
-		return nil, fmt.Errorf("create session logon failed: %v", err)
+		return nil, fmt.Errorf("create session logon failed: %w", err)
 	}
 	if resp.Er != KCSuccess {
-		return nil, fmt.Errorf("create session logon mapi error: %v", resp.Er)
+		return nil, fmt.Errorf("create session logon mapi error: %w", NewMethodError("logon", resp.Er))
 	}
 	if resp.SessionID == KCNoSessionID {
 		return nil, fmt.Errorf("create session logon returned invalid session ID")
@@ -96,6 +122,8 @@ func NewSession(ctx context.Context, c *KCC, username, password string) (*Sessio
 		c:         c,
 	}
 
+	s.notify(SessionEventCreated)
+
 	err = s.StartAutoRefresh()
 	return s, err
 }
@@ -112,10 +140,10 @@ func NewSSOSession(ctx context.Context, c *KCC, prefix SSOType, username string,
 
 	resp, err := c.SSOLogon(ctx, prefix, username, input, sessionID, 0)
 	if err != nil {
-		return nil, fmt.Errorf("create session sso logon failed: %v", err)
+		return nil, fmt.Errorf("create session sso logon failed: %w", err)
 	}
 	if resp.Er != KCSuccess {
-		return nil, fmt.Errorf("create session sso logon mapi error: %v", resp.Er)
+		return nil, fmt.Errorf("create session sso logon mapi error: %w", NewMethodError("ssoLogon", resp.Er))
 	}
 	if resp.SessionID == KCNoSessionID {
 		return nil, fmt.Errorf("create session sso logon returned invalid session ID")
@@ -137,6 +165,8 @@ func NewSSOSession(ctx context.Context, c *KCC, prefix SSOType, username string,
 		c:         c,
 	}
 
+	s.notify(SessionEventCreated)
+
 	err = s.StartAutoRefresh()
 	return s, err
 }
@@ -169,6 +199,7 @@ func CreateSession(ctx context.Context, c *KCC, id KCSessionID, serverGUID strin
 
 	if active {
 		s.when = time.Now()
+		s.notify(SessionEventCreated)
 	}
 
 	return s, nil
@@ -187,7 +218,7 @@ func (s *Session) IsActive() bool {
 	when := s.when
 	s.mutex.RUnlock()
 
-	return active && !when.Before(time.Now().Add(-(SessionAutorefreshInterval + SessionExpirationGrace)))
+	return active && !when.Before(time.Now().Add(-(s.c.autorefreshInterval() + SessionExpirationGrace)))
 }
 
 // ID returns the accociated Session's ID.
@@ -207,21 +238,28 @@ func (s *Session) Destroy(ctx context.Context, logoff bool) error {
 	s.active = false
 	s.mutex.Unlock()
 	s.ctxCancel()
+	s.notify(SessionEventDestroyed)
 
 	if logoff {
 		resp, err := s.c.Logoff(ctx, s.id)
 		if err != nil {
-			return fmt.Errorf("logoff session logoff failed: %v", err)
+			return fmt.Errorf("logoff session logoff failed: %w", err)
 		}
 
 		if resp.Er != KCSuccess {
-			return fmt.Errorf("logoff session logoff error: %v", resp.Er)
+			return fmt.Errorf("logoff session logoff error: %w", NewMethodError("logoff", resp.Er))
 		}
 	}
 
 	return nil
 }
 
+func (s *Session) notify(event SessionEvent) {
+	if s.c != nil && s.c.SessionEventHandler != nil {
+		s.c.SessionEventHandler(s, event)
+	}
+}
+
 func (s *Session) String() string {
 	return fmt.Sprintf("Session(%s@%s)", s.id, s.serverGUID)
 }
@@ -238,14 +276,15 @@ func (s *Session) Refresh() error {
 
 	resp, err := s.c.ResolveUsername(s.ctx, "SYSTEM", s.id)
 	if err != nil {
-		return fmt.Errorf("refresh session resolveUsername failed: %v", err)
+		return fmt.Errorf("refresh session resolveUsername failed: %w", err)
 	}
 	if resp.Er != KCSuccess {
-		return fmt.Errorf("refresh session resolveUsername mapi error: %v", resp.Er)
+		return fmt.Errorf("refresh session resolveUsername mapi error: %w", NewMethodError("resolveUsername", resp.Er))
 	}
 	s.mutex.Lock()
 	s.when = time.Now()
 	s.mutex.Unlock()
+	s.notify(SessionEventRefreshed)
 
 	return nil
 }
@@ -276,7 +315,7 @@ func (s *Session) StopAutoRefresh() error {
 
 func (s *Session) runAutoRefresh(stop chan bool) error {
 	ctx := s.Context()
-	ticker := time.NewTicker(SessionAutorefreshInterval)
+	ticker := time.NewTicker(s.c.autorefreshInterval())
 	go func() {
 		for {
 			select {
@@ -286,7 +325,11 @@ func (s *Session) runAutoRefresh(stop chan bool) error {
 			case <-ticker.C:
 				err := s.Refresh()
 				if err != nil {
-					s.Destroy(ctx, err != KCERR_END_OF_SESSION)
+					ended := IsSessionEnded(err)
+					if ended {
+						s.notify(SessionEventExpired)
+					}
+					s.Destroy(ctx, !ended)
 					s.StopAutoRefresh()
 				}
 			case <-stop:
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCreateSessionWithoutKCC(t *testing.T) {
+	s, err := CreateSession(context.Background(), nil, 1, "test", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsActive() {
+		t.Errorf("session without KCC is not active")
+	}
+}
+
+func TestSessionAutoRefreshExpired(t *testing.T) {
+	for _, refreshErr := range []error{io.ErrUnexpectedEOF, KCERR_END_OF_SESSION} {
+		c := NewKCCWithClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+			if _, ok := v.(*ResolveUserResponse); !ok {
+				return nil
+			}
+			if er, ok := refreshErr.(KCError); ok {
+				v.(*ResolveUserResponse).Er = er
+				return nil
+			}
+			return refreshErr
+		}))
+		c.sessionAutorefreshInterval = 10 * time.Millisecond
+
+		var mutex sync.Mutex
+		var events []SessionEvent
+		destroyed := make(chan struct{})
+		c.SessionEventHandler = func(session *Session, event SessionEvent) {
+			mutex.Lock()
+			events = append(events, event)
+			mutex.Unlock()
+			if event == SessionEventDestroyed {
+				close(destroyed)
+			}
+		}
+
+		s, err := CreateSession(context.Background(), c, 1, "test", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = s.StartAutoRefresh(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-destroyed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("session was not destroyed on refresh error %v", refreshErr)
+		}
+
+		mutex.Lock()
+		expired := false
+		for _, event := range events {
+			expired = expired || event == SessionEventExpired
+		}
+		mutex.Unlock()
+		if ended := errors.Is(refreshErr, KCERR_END_OF_SESSION); expired != ended {
+			t.Errorf("unexpected expired event %v for refresh error %v: %v", expired, refreshErr, events)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// SOAP 1.1 fault codes as defined in section 4.4.1 of the SOAP 1.1 spec.
+const (
+	SOAPFaultVersionMismatch = "VersionMismatch"
+	SOAPFaultMustUnderstand  = "MustUnderstand"
+	SOAPFaultClient          = "Client"
+	SOAPFaultServer          = "Server"
+)
+
+// A SOAPFault is the error returned when the server responds with a SOAP
+// Fault element.
+type SOAPFault struct {
+	// StatusCode is the HTTP status code of the response containing the fault.
+	StatusCode int `xml:"-"`
+
+	Code   string `xml:"faultcode"`
+	String string `xml:"faultstring"`
+	Actor  string `xml:"faultactor"`
+	// Detail is the text content of the fault detail element.
+	Detail string `xml:"-"`
+}
+
+// soapFaultElement is the XML representation of a SOAP 1.1 Fault.
+type soapFaultElement struct {
+	SOAPFault
+	DetailElement *soapFaultDetail `xml:"detail"`
+}
+
+// soapFaultDetail is the text content of a SOAP Fault detail element.
+type soapFaultDetail string
+
+// UnmarshalXML implements the xml.Unmarshaler interface, collecting the text
+// of the provided element and all its child elements.
+func (detail *soapFaultDetail) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var b strings.Builder
+	for depth := 1; depth > 0; {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch tt := t.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			b.Write(tt)
+		}
+	}
+	*detail = soapFaultDetail(strings.TrimSpace(b.String()))
+
+	return nil
+}
+
+func (f *SOAPFault) Error() string {
+	if f.Detail != "" {
+		return fmt.Sprintf("soap fault %s: %s (%s)", f.Code, f.String, f.Detail)
+	}
+	return fmt.Sprintf("soap fault %s: %s", f.Code, f.String)
+}
+
+// CodeName returns the fault code of the associated SOAPFault without its
+// namespace prefix, for example "Client" for "SOAP-ENV:Client".
+func (f *SOAPFault) CodeName() string {
+	code := f.Code
+	if idx := strings.LastIndexByte(code, ':'); idx >= 0 {
+		code = code[idx+1:]
+	}
+	return code
+}
+
+// IsVersionMismatch returns true if the associated SOAPFault signals that the
+// server does not support the SOAP envelope sent by the client.
+func (f *SOAPFault) IsVersionMismatch() bool {
+	return f.CodeName() == SOAPFaultVersionMismatch
+}
+
+// IsClientFault returns true if the associated SOAPFault signals a protocol
+// error, that is the request was malformed or not understood by the server.
+func (f *SOAPFault) IsClientFault() bool {
+	code := f.CodeName()
+	return code == SOAPFaultClient || strings.HasPrefix(code, SOAPFaultClient+".") || code == SOAPFaultMustUnderstand
+}
+
+// IsServerFault returns true if the associated SOAPFault signals that the
+// server failed to process an otherwise valid request.
+func (f *SOAPFault) IsServerFault() bool {
+	code := f.CodeName()
+	return code == SOAPFaultServer || strings.HasPrefix(code, SOAPFaultServer+".")
+}
+
+// decodeSOAPFault decodes the provided Fault start element into a SOAPFault.
+func decodeSOAPFault(code int, decoder *xml.Decoder, se *xml.StartElement) error {
+	var fault soapFaultElement
+	if err := decoder.DecodeElement(&fault, se); err != nil {
+		return fmt.Errorf("failed to unmarshal SOAP fault: %w", err)
+	}
+	if fault.DetailElement != nil {
+		fault.Detail = string(*fault.DetailElement)
+	}
+	fault.StatusCode = code
+
+	return &fault.SOAPFault
+}
+
+// An HTTPStatusError is the error returned when the server responds with an
+// unexpected HTTP status code and without SOAP Fault.
+type HTTPStatusError struct {
+	StatusCode int
+}
+
+func (err *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected http response status: %v", err.StatusCode)
+}
+
+// Temporary returns true if the associated HTTPStatusError signals that the
+// server or a proxy in front of it is temporarily unavailable.
+func (err *HTTPStatusError) Temporary() bool {
+	switch err.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseSOAPErrorResponse returns the error for a response with the provided
+// non-OK HTTP status code. If the response contains a SOAP Fault, it is
+// returned as *SOAPFault, otherwise an *HTTPStatusError is returned.
+func parseSOAPErrorResponse(code int, data io.Reader, limits responseLimits) error {
+	err := parseSOAPResponse(code, data, nil, limits)
+	if fault, ok := err.(*SOAPFault); ok {
+		return fault
+	}
+	return &HTTPStatusError{
+		StatusCode: code,
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestSOAPFault(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		body   string
+
+		fault           *SOAPFault
+		versionMismatch bool
+		clientFault     bool
+		serverFault     bool
+		temporary       bool
+	}{
+		{
+			status: http.StatusInternalServerError,
+			body:   testSOAPResponse("<SOAP-ENV:Fault><faultcode>SOAP-ENV:Client</faultcode><faultstring>Method 'ns:foo' not implemented</faultstring></SOAP-ENV:Fault>"),
+			fault: &SOAPFault{
+				StatusCode: http.StatusInternalServerError,
+				Code:       "SOAP-ENV:Client",
+				String:     "Method 'ns:foo' not implemented",
+			},
+			clientFault: true,
+		},
+		{
+			status: http.StatusOK,
+			body:   testSOAPResponse("<SOAP-ENV:Fault><faultcode>SOAP-ENV:Server</faultcode><faultstring>Internal error</faultstring><detail><ns:reason>crash</ns:reason></detail></SOAP-ENV:Fault>"),
+			fault: &SOAPFault{
+				StatusCode: http.StatusOK,
+				Code:       "SOAP-ENV:Server",
+				String:     "Internal error",
+				Detail:     "crash",
+			},
+			serverFault: true,
+		},
+		{
+			status: http.StatusInternalServerError,
+			body:   testSOAPResponse("<SOAP-ENV:Fault><faultcode>SOAP-ENV:VersionMismatch</faultcode><faultstring>Invalid SOAP message or SOAP version mismatch</faultstring></SOAP-ENV:Fault>"),
+			fault: &SOAPFault{
+				StatusCode: http.StatusInternalServerError,
+				Code:       "SOAP-ENV:VersionMismatch",
+				String:     "Invalid SOAP message or SOAP version mismatch",
+			},
+			versionMismatch: true,
+		},
+		{
+			status:    http.StatusServiceUnavailable,
+			body:      "unavailable",
+			temporary: true,
+		},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(tc.status)
+			fmt.Fprint(rw, tc.body)
+		}))
+
+		uri, _ := url.Parse(srv.URL)
+		client, err := NewSOAPHTTPClient(uri, srv.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewKCCWithClient(client).ResolveUsername(context.Background(), "user1", 1)
+		srv.Close()
+
+		var fault *SOAPFault
+		if tc.fault != nil {
+			if !errors.As(err, &fault) {
+				t.Errorf("expected SOAP fault, got %v", err)
+				continue
+			}
+			if *fault != *tc.fault {
+				t.Errorf("unexpected SOAP fault, got %+v, expected %+v", fault, tc.fault)
+			}
+			if fault.IsVersionMismatch() != tc.versionMismatch || fault.IsClientFault() != tc.clientFault || fault.IsServerFault() != tc.serverFault {
+				t.Errorf("unexpected SOAP fault classification: %v", fault)
+			}
+		} else {
+			var statusErr *HTTPStatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tc.status {
+				t.Errorf("expected HTTP status error, got %v", err)
+			}
+		}
+		if IsTemporary(err) != tc.temporary {
+			t.Errorf("unexpected temporary result for %v", err)
+		}
+	}
+}
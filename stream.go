@@ -0,0 +1,303 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A SOAPResponseDecoder decodes the response element of a successful SOAP
+// response, that is the first child of the SOAP Body. Like the UnmarshalXML
+// method of xml.Unmarshaler, it must consume all tokens up to and including
+// the end element matching the provided start element.
+type SOAPResponseDecoder func(d *xml.Decoder, start xml.StartElement) error
+
+// A SOAPStreamClient is a network client which sends SOAP requests with a
+// streamed payload. Unlike SOAPClient, the payload is never held in memory
+// as a whole and the response is decoded by a callback while it is read.
+type SOAPStreamClient interface {
+	// DoStreamRequest sends the payload read from the provided reader as
+	// SOAP body and calls the provided decoder with the response. The method
+	// is the name of the called SOAP method, used for logging. SOAP faults
+	// and HTTP errors are returned as error without calling the decoder.
+	DoStreamRequest(ctx context.Context, method string, payload io.Reader, decode SOAPResponseDecoder) error
+}
+
+// NewSOAPStreamClient returns a SOAPStreamClient for the provided client. If
+// the client does not support streaming itself, the returned adapter reads
+// the payload into memory and sends it with the DoRequest method of the
+// provided client. The retrying, limiting, circuit breaking and fault
+// injecting clients stream through to the client they wrap.
+func NewSOAPStreamClient(client SOAPClient) SOAPStreamClient {
+	if sc, ok := client.(SOAPStreamClient); ok {
+		return sc
+	}
+	return &soapStreamClientAdapter{
+		Client: client,
+	}
+}
+
+// A soapStreamClientAdapter implements SOAPStreamClient with a SOAPClient.
+type soapStreamClientAdapter struct {
+	Client SOAPClient
+}
+
+func (a *soapStreamClientAdapter) DoStreamRequest(ctx context.Context, method string, payload io.Reader, decode SOAPResponseDecoder) error {
+	data, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return fmt.Errorf("failed to read SOAP payload: %w", err)
+	}
+	s := string(data)
+
+	return a.Client.DoRequest(ctx, &s, &soapStreamResponse{
+		decode: decode,
+	})
+}
+
+func (a *soapStreamClientAdapter) String() string {
+	return fmt.Sprintf("<stream:%s>", a.Client)
+}
+
+// A soapStreamResponse passes the response element to a SOAPResponseDecoder
+// when unmarshaled.
+type soapStreamResponse struct {
+	decode  SOAPResponseDecoder
+	decoded bool
+}
+
+func (r *soapStreamResponse) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	r.decoded = true
+	return r.decode(d, start)
+}
+
+// responseDelivered implements the deliveringResponse interface. Once the
+// decoder was called, the request must not be retried.
+func (r *soapStreamResponse) responseDelivered() bool {
+	return r.decoded
+}
+
+// resetResponse implements the responseResetter interface, keeping the
+// decoder.
+func (r *soapStreamResponse) resetResponse() {
+	r.decoded = false
+}
+
+// NewSOAPPayloadReader returns a reader for the payload written by the
+// provided function. When sent by a SOAPStreamClient, the payload is written
+// directly into the request body without intermediate buffer. Otherwise the
+// function runs in its own goroutine, writing into a pipe which is read by
+// the returned reader. Closing the reader aborts pending writes with
+// io.ErrClosedPipe.
+func NewSOAPPayloadReader(write func(w io.Writer) error) io.ReadCloser {
+	return &streamBody{
+		write: write,
+	}
+}
+
+// A streamBody is a reader for data written by a function. It implements
+// io.WriterTo to write the data directly and uses a pipe for reads.
+type streamBody struct {
+	write func(w io.Writer) error
+
+	mutex   sync.Mutex
+	started bool
+	closed  bool
+	pr      *io.PipeReader
+}
+
+// pipe returns the reader of the pipe written by the accociated function,
+// starting it on first use. If the data was already written with WriteTo or
+// the body was closed, it returns an error instead.
+func (b *streamBody) pipe() (*io.PipeReader, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.pr == nil && b.closed {
+		return nil, io.ErrClosedPipe
+	}
+	if !b.started {
+		b.started = true
+		pr, pw := io.Pipe()
+		b.pr = pr
+		go func() {
+			pw.CloseWithError(b.write(pw))
+		}()
+	}
+	if b.pr == nil {
+		return nil, io.EOF
+	}
+	return b.pr, nil
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	pr, err := b.pipe()
+	if err != nil {
+		return 0, err
+	}
+	return pr.Read(p)
+}
+
+// WriteTo implements the io.WriterTo interface, calling the accociated
+// function with the provided writer unless reading already started.
+func (b *streamBody) WriteTo(w io.Writer) (int64, error) {
+	b.mutex.Lock()
+	direct := !b.started && !b.closed
+	b.started = true
+	b.mutex.Unlock()
+
+	if !direct {
+		pr, err := b.pipe()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return 0, err
+		}
+		return io.Copy(w, pr)
+	}
+
+	cw := &countingWriter{w: w}
+	err := b.write(cw)
+	return cw.n, err
+}
+
+func (b *streamBody) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.closed = true
+	if b.pr != nil {
+		return b.pr.Close()
+	}
+	return nil
+}
+
+// A countingWriter counts the bytes written to the accociated writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// A readTrackingReader records whether reading from the accociated reader
+// started, to tell whether a payload can still be sent again.
+type readTrackingReader struct {
+	r    io.Reader
+	read int32
+}
+
+func (tr *readTrackingReader) Read(p []byte) (int, error) {
+	atomic.StoreInt32(&tr.read, 1)
+	return tr.r.Read(p)
+}
+
+// WriteTo implements the io.WriterTo interface, so payloads written by a
+// function are still written directly.
+func (tr *readTrackingReader) WriteTo(w io.Writer) (int64, error) {
+	atomic.StoreInt32(&tr.read, 1)
+	return io.Copy(w, tr.r)
+}
+
+func (tr *readTrackingReader) wasRead() bool {
+	return atomic.LoadInt32(&tr.read) != 0
+}
+
+// newSOAPStreamRequest creates a HTTP request streaming the SOAP envelope of
+// the provided payload. If request compression is enabled, the envelope is
+// always compressed since its size is unknown.
+func newSOAPStreamRequest(ctx context.Context, url string, payload io.Reader, compression *SOAPCompression) (*http.Request, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	compressed := compression != nil && compression.RequestThreshold >= 0
+	body := &streamBody{
+		write: func(w io.Writer) error {
+			envelope := io.MultiReader(strings.NewReader(soapHeader), payload, strings.NewReader(soapFooter))
+			if compressed {
+				return compression.writeRequest(w, envelope)
+			}
+			_, err := io.Copy(w, envelope)
+			return err
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = -1
+	setSOAPRequestHeaders(ctx, req, compression, compressed)
+
+	return req, nil
+}
+
+// DoStreamRequest sends the payload read from the provided reader as SOAP
+// through the means of the accociated client and calls the provided decoder
+// with the response.
+func (sc *SOAPHTTPClient) DoStreamRequest(ctx context.Context, method string, payload io.Reader, decode SOAPResponseDecoder) (err error) {
+	logger := soapClientLogger(sc.Logger)
+	if logger != nil {
+		logSOAPStreamRequest(logger, method)
+		defer func(started time.Time) {
+			logSOAPDone(logger, method, started, err)
+		}(time.Now())
+	}
+
+	req, err := newSOAPStreamRequest(ctx, sc.URI, payload, sc.Compression)
+	if err != nil {
+		return err
+	}
+
+	return sc.do(ctx, logger, method, req, &soapStreamResponse{
+		decode: decode,
+	})
+}
+
+// DoStreamRequest sends the payload read from the provided reader as SOAP
+// through the means of the accociated client and calls the provided decoder
+// with the response. Requests are not retried on stale connections since the
+// payload cannot be read again.
+func (sc *SOAPSocketClient) DoStreamRequest(ctx context.Context, method string, payload io.Reader, decode SOAPResponseDecoder) (err error) {
+	logger := soapClientLogger(sc.Logger)
+	if logger != nil {
+		logSOAPStreamRequest(logger, method)
+		defer func(started time.Time) {
+			logSOAPDone(logger, method, started, err)
+		}(time.Now())
+	}
+
+	return sc.do(ctx, logger, method, func(ctx context.Context) (*http.Request, error) {
+		return newSOAPStreamRequest(ctx, "http://unix/", payload, sc.Compression)
+	}, 0, &soapStreamResponse{
+		decode: decode,
+	})
+}
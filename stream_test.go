@@ -0,0 +1,321 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newStreamTestHandler returns a handler which answers with the number of
+// items in the request and stores the received envelope.
+func newStreamTestHandler(received *string) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var body io.Reader = req.Body
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			gr, err := gzip.NewReader(req.Body)
+			if err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = gr
+		}
+		data, _ := ioutil.ReadAll(body)
+		*received = string(data)
+
+		if !bytes.Contains(data, []byte("<ns:importMessage>")) {
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(rw, testSOAPResponse(`<SOAP-ENV:Fault><faultcode>SOAP-ENV:Client</faultcode><faultstring>unknown method</faultstring></SOAP-ENV:Fault>`))
+			return
+		}
+		fmt.Fprint(rw, testSOAPResponse(fmt.Sprintf(`<ns:importMessageResponse><er>0</er><items>%d</items></ns:importMessageResponse>`, bytes.Count(data, []byte("<item>")))))
+	})
+}
+
+type testImportMessageResponse struct {
+	Er    KCError `xml:"er"`
+	Items int     `xml:"items"`
+}
+
+func testStreamPayload(items int) io.ReadCloser {
+	return NewSOAPPayloadReader(func(w io.Writer) error {
+		if _, err := io.WriteString(w, "<ns:importMessage><data>"); err != nil {
+			return err
+		}
+		for idx := 0; idx < items; idx++ {
+			if _, err := fmt.Fprintf(w, "<item>%d</item>", idx); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "</data></ns:importMessage>")
+		return err
+	})
+}
+
+func testStreamRequest(t *testing.T, client SOAPStreamClient, received *string) {
+	var resp testImportMessageResponse
+	err := client.DoStreamRequest(context.Background(), "importMessage", testStreamPayload(10000), func(d *xml.Decoder, start xml.StartElement) error {
+		return d.DecodeElement(&resp, &start)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Items != 10000 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if !strings.HasPrefix(*received, soapHeader) || !strings.HasSuffix(*received, soapFooter) {
+		t.Errorf("payload was not sent in SOAP envelope")
+	}
+
+	called := false
+	err = client.DoStreamRequest(context.Background(), "unknown", strings.NewReader("<ns:unknown/>"), func(d *xml.Decoder, start xml.StartElement) error {
+		called = true
+		return d.Skip()
+	})
+	var fault *SOAPFault
+	if !errors.As(err, &fault) || !fault.IsClientFault() {
+		t.Errorf("expected SOAP fault, got %v", err)
+	}
+	if called {
+		t.Errorf("decoder was called for SOAP fault")
+	}
+}
+
+func TestSOAPHTTPClientDoStreamRequest(t *testing.T) {
+	var received string
+	srv := httptest.NewServer(newStreamTestHandler(&received))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Compression = DefaultSOAPCompression
+
+	testStreamRequest(t, client, &received)
+}
+
+func TestSOAPSocketClientDoStreamRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kcc-go-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "server.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var received string
+	go http.Serve(listener, newStreamTestHandler(&received))
+
+	client, err := NewSOAPSocketClient(&url.URL{Scheme: "file", Path: path}, &net.Dialer{
+		Timeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStreamRequest(t, client, &received)
+}
+
+func TestNewSOAPStreamClientAdapter(t *testing.T) {
+	var received string
+	client := NewSOAPStreamClient(testSOAPClient(func(ctx context.Context, payload *string, v interface{}) error {
+		received = *payload
+		return parseSOAPResponse(http.StatusOK, strings.NewReader(testSOAPResponse(testResolveUsernameResponse)), v, newResponseLimits(0, 0))
+	}))
+	if _, ok := client.(*soapStreamClientAdapter); !ok {
+		t.Fatalf("unexpected stream client: %v", client)
+	}
+
+	var resp ResolveUserResponse
+	err := client.DoStreamRequest(context.Background(), "resolveUsername", testStreamPayload(2), func(d *xml.Decoder, start xml.StartElement) error {
+		return d.DecodeElement(&resp, &start)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != 42 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if received != "<ns:importMessage><data><item>0</item><item>1</item></data></ns:importMessage>" {
+		t.Errorf("unexpected payload: %s", received)
+	}
+
+	uri, _ := url.Parse("http://127.0.0.1:236")
+	httpClient, _ := NewSOAPHTTPClient(uri, nil)
+	if NewSOAPStreamClient(httpClient) != SOAPStreamClient(httpClient) {
+		t.Errorf("streaming client was wrapped in adapter")
+	}
+}
+
+// A testSOAPStreamClient answers requests with the provided SOAP response and
+// records the received payloads and whether they were streamed.
+type testSOAPStreamClient struct {
+	response string
+	err      func(attempt int) error
+
+	attempts int
+	streamed bool
+	received string
+}
+
+func (tc *testSOAPStreamClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	tc.attempts++
+	tc.received = *payload
+	return parseSOAPResponse(http.StatusOK, strings.NewReader(testSOAPResponse(tc.response)), v, newResponseLimits(0, 0))
+}
+
+func (tc *testSOAPStreamClient) DoStreamRequest(ctx context.Context, method string, payload io.Reader, decode SOAPResponseDecoder) error {
+	tc.attempts++
+	tc.streamed = true
+	if tc.err != nil {
+		if err := tc.err(tc.attempts); err != nil {
+			return err
+		}
+	}
+	data, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return err
+	}
+	tc.received = string(data)
+	return parseSOAPResponse(http.StatusOK, strings.NewReader(testSOAPResponse(tc.response)), &soapStreamResponse{
+		decode: decode,
+	}, newResponseLimits(0, 0))
+}
+
+func TestSOAPStreamClientWrappers(t *testing.T) {
+	limiter := func(client SOAPClient) SOAPClient {
+		lc, err := NewLimitingSOAPClient(client, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lc
+	}
+	for _, test := range []struct {
+		name     string
+		wrap     func(client SOAPClient) SOAPClient
+		streamed bool
+	}{
+		{"retry", func(client SOAPClient) SOAPClient { return NewRetryingSOAPClient(client, nil) }, true},
+		{"limiter", limiter, true},
+		{"breaker", func(client SOAPClient) SOAPClient { return NewCircuitBreakerSOAPClient(client, 0, 0) }, true},
+		{"faults", func(client SOAPClient) SOAPClient { return NewFaultInjectingSOAPClient(client, 1) }, true},
+		{"chain", func(client SOAPClient) SOAPClient {
+			return ChainSOAPClient(client, func(ctx context.Context, call *SOAPCall, payload *string, v interface{}, invoker SOAPInvoker) error {
+				return invoker(ctx, payload, v)
+			})
+		}, false},
+		{"failover", func(client SOAPClient) SOAPClient {
+			return newFailoverSOAPClient([]*failoverEndpoint{{uri: "primary", client: client, healthy: true}})
+		}, false},
+		{"record", func(client SOAPClient) SOAPClient { return NewRecordingSOAPClient(client, ioutil.Discard) }, false},
+	} {
+		inner := &testSOAPStreamClient{response: testResolveUsernameResponse}
+		wrapped := test.wrap(inner)
+		client := NewSOAPStreamClient(wrapped)
+		if _, adapted := client.(*soapStreamClientAdapter); adapted == test.streamed {
+			t.Errorf("%s: unexpected stream client: %v", test.name, client)
+		}
+
+		var resp ResolveUserResponse
+		err := client.DoStreamRequest(context.Background(), "importMessage", testStreamPayload(2), func(d *xml.Decoder, start xml.StartElement) error {
+			return d.DecodeElement(&resp, &start)
+		})
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if resp.ID != 42 || inner.streamed != test.streamed {
+			t.Errorf("%s: unexpected result, streamed %v: %+v", test.name, inner.streamed, resp)
+		}
+		if inner.received != "<ns:importMessage><data><item>0</item><item>1</item></data></ns:importMessage>" {
+			t.Errorf("%s: unexpected payload: %s", test.name, inner.received)
+		}
+	}
+}
+
+func TestRetryingSOAPClientDoStreamRequest(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}
+
+	inner := &testSOAPStreamClient{
+		response: testResolveUsernameResponse,
+		err: func(attempt int) error {
+			if attempt == 1 {
+				return errTestDial
+			}
+			return nil
+		},
+	}
+	var resp ResolveUserResponse
+	err := NewRetryingSOAPClient(inner, policy).DoStreamRequest(context.Background(), "resolveUsername", strings.NewReader("<ns:resolveUsername/>"), func(d *xml.Decoder, start xml.StartElement) error {
+		return d.DecodeElement(&resp, &start)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inner.attempts != 2 || resp.ID != 42 || inner.received != "<ns:resolveUsername/>" {
+		t.Errorf("unexpected result after %d attempts: %+v", inner.attempts, resp)
+	}
+
+	// Once the payload was read, the request cannot be sent again.
+	unavailable := &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}
+	attempts := 0
+	client := NewRetryingSOAPClient(testSOAPStreamClientFunc(func(ctx context.Context, method string, payload io.Reader, decode SOAPResponseDecoder) error {
+		attempts++
+		ioutil.ReadAll(payload)
+		return unavailable
+	}), policy)
+	err = client.DoStreamRequest(context.Background(), "resolveUsername", strings.NewReader("<ns:resolveUsername/>"), func(d *xml.Decoder, start xml.StartElement) error {
+		return d.Skip()
+	})
+	if err != unavailable || attempts != 1 {
+		t.Errorf("request with read payload was retried: %d attempts, %v", attempts, err)
+	}
+}
+
+// A testSOAPStreamClientFunc implements SOAPStreamClient with a function.
+type testSOAPStreamClientFunc func(ctx context.Context, method string, payload io.Reader, decode SOAPResponseDecoder) error
+
+func (tc testSOAPStreamClientFunc) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	return errors.New("payload was not streamed")
+}
+
+func (tc testSOAPStreamClientFunc) DoStreamRequest(ctx context.Context, method string, payload io.Reader, decode SOAPResponseDecoder) error {
+	return tc(ctx, method, payload, decode)
+}
@@ -17,9 +17,20 @@
 package kcc
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
 )
 
+// ErrCertificatePinMismatch is the error returned when the certificates of a
+// TLS server do not match any of the pinned SPKI hashes.
+var ErrCertificatePinMismatch = errors.New("tls: no certificate matches pinned public key")
+
 // SetX509KeyPairToTLSConfig reads and parses a public/private key pair from a
 // pair of files and adds the resulting certificate to the provided TLs config.
 // If the provided TLS config is nil, a new empty one will be created and
@@ -37,3 +48,107 @@ func SetX509KeyPairToTLSConfig(certFile, keyFile string, config *tls.Config) (*t
 
 	return config, nil
 }
+
+// LoadCertPool reads PEM encoded certificates from the provided file and
+// returns a new x509.CertPool containing them, for example to trust a private
+// CA bundle.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+
+	return pool, nil
+}
+
+// SPKISHA256 returns the base64 encoded SHA-256 hash of the DER encoded
+// SubjectPublicKeyInfo of the provided certificate as used for pinning.
+func SPKISHA256(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// newTLSClientConfig returns a copy of the provided TLS config, or a new one
+// if nil, which trusts the provided root CAs if set and only accepts servers
+// matching one of the provided base64 encoded SPKI SHA-256 hashes if set.
+func newTLSClientConfig(config *tls.Config, rootCAs *x509.CertPool, pins []string) (*tls.Config, error) {
+	if config != nil {
+		config = config.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+	if rootCAs != nil {
+		config.RootCAs = rootCAs
+	}
+	if config.ClientSessionCache != nil && (rootCAs != nil || len(pins) > 0) {
+		// Certificates are not verified again when resuming sessions, so
+		// sessions verified with other settings must not be shared.
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+
+	if len(pins) > 0 {
+		hashes := make([][]byte, 0, len(pins))
+		for _, pin := range pins {
+			hash, err := base64.StdEncoding.DecodeString(pin)
+			if err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("invalid SPKI SHA-256 pin: %s", pin)
+			}
+			hashes = append(hashes, hash)
+		}
+		config.VerifyPeerCertificate = verifySPKIPins(hashes, config.VerifyPeerCertificate)
+	}
+
+	return config, nil
+}
+
+// verifySPKIPins returns a function for tls.Config.VerifyPeerCertificate which
+// accepts servers with a verified chain containing a certificate matching one
+// of the provided hashes. Without verified chains, that is when certificate
+// verification is disabled, only the leaf certificate is matched. The
+// provided next function is called first if not nil.
+func verifySPKIPins(hashes [][]byte, next func([][]byte, [][]*x509.Certificate) error) func([][]byte, [][]*x509.Certificate) error {
+	match := func(cert *x509.Certificate) bool {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		for _, hash := range hashes {
+			if bytes.Equal(sum[:], hash) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if next != nil {
+			if err := next(rawCerts, verifiedChains); err != nil {
+				return err
+			}
+		}
+
+		if len(verifiedChains) == 0 {
+			if len(rawCerts) > 0 {
+				cert, err := x509.ParseCertificate(rawCerts[0])
+				if err != nil {
+					return err
+				}
+				if match(cert) {
+					return nil
+				}
+			}
+			return ErrCertificatePinMismatch
+		}
+
+		for _, chain := range verifiedChains {
+			for _, cert := range chain {
+				if match(cert) {
+					return nil
+				}
+			}
+		}
+		return ErrCertificatePinMismatch
+	}
+}
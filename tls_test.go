@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func newTestResolveUsernameServer(tls bool) *httptest.Server {
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(rw, testSOAPResponse(testResolveUsernameResponse))
+	})
+	if tls {
+		return httptest.NewTLSServer(handler)
+	}
+	return httptest.NewServer(handler)
+}
+
+func TestSOAPClientConfigTLS(t *testing.T) {
+	srv := newTestResolveUsernameServer(true)
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	transport := DefaultHTTPClient.Transport.(*http.Transport)
+	tlsConfig := transport.TLSClientConfig
+
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	for idx, test := range []struct {
+		config   *SOAPClientConfig
+		expected error
+	}{
+		{&SOAPClientConfig{}, nil},
+		{&SOAPClientConfig{RootCAs: pool}, nil},
+		{&SOAPClientConfig{RootCAs: pool, PinnedSPKI: []string{SPKISHA256(srv.Certificate())}}, nil},
+		{&SOAPClientConfig{RootCAs: pool, PinnedSPKI: []string{otherPin}}, ErrCertificatePinMismatch},
+	} {
+		client, err := NewSOAPClientWithConfig(uri, test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := NewKCCWithClient(client).ResolveUsername(context.Background(), "user1", 1)
+		switch {
+		case idx == 0:
+			// Default client does not trust the test server.
+			var certErr x509.UnknownAuthorityError
+			if !errors.As(err, &certErr) {
+				t.Errorf("config %d: expected unknown authority error, got %v", idx, err)
+			}
+		case test.expected != nil:
+			if !errors.Is(err, test.expected) {
+				t.Errorf("config %d: expected %v, got %v", idx, test.expected, err)
+			}
+		case err != nil || resp.ID != 42:
+			t.Errorf("config %d: unexpected result %v %+v", idx, err, resp)
+		}
+	}
+
+	if _, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{PinnedSPKI: []string{"invalid"}}); err == nil {
+		t.Errorf("expected error for invalid pin")
+	}
+	if DefaultHTTPClient.Transport != transport || transport.TLSClientConfig != tlsConfig {
+		t.Errorf("default HTTP client was modified")
+	}
+
+	jar, _ := cookiejar.New(nil)
+	httpClient := &http.Client{Jar: jar}
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{HTTPClient: httpClient, RootCAs: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := client.(*SOAPHTTPClient).Client; c == httpClient || c.Jar != nil {
+		t.Errorf("cookie jar of configured HTTP client was shared")
+	}
+	if httpClient.Jar != jar {
+		t.Errorf("configured HTTP client was modified")
+	}
+}
+
+func TestSOAPClientConfigProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		proxied = req.URL.Host
+		fmt.Fprint(rw, testSOAPResponse(testResolveUsernameResponse))
+	}))
+	defer proxy.Close()
+
+	proxyURI, _ := url.Parse(proxy.URL)
+	uri, _ := url.Parse("http://kopano.example.com:236")
+	c, err := New(uri, WithHTTPProxy(proxyURI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.ResolveUsername(context.Background(), "user1", 1)
+	if err != nil || resp.ID != 42 {
+		t.Fatalf("unexpected result %v %+v", err, resp)
+	}
+	if proxied != uri.Host {
+		t.Errorf("request was not sent through proxy: %s", proxied)
+	}
+
+	proxyURI.Scheme = "ftp"
+	if _, err = New(uri, WithHTTPProxy(proxyURI)); err == nil {
+		t.Errorf("expected error for unsupported proxy scheme")
+	}
+}
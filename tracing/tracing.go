@@ -0,0 +1,147 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tracing provides optional OpenTelemetry instrumentation for kcc-go
+// SOAP clients.
+package tracing // import "stash.kopano.io/kgol/kcc-go/v5/tracing"
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"stash.kopano.io/kgol/kcc-go/v5"
+)
+
+// InstrumentationName is the name of the tracer used when no tracer is
+// provided.
+const InstrumentationName = "stash.kopano.io/kgol/kcc-go/v5"
+
+// Span attribute keys set by the Interceptor.
+const (
+	MethodKey       = attribute.Key("kcc.soap.method")
+	ServerURIKey    = attribute.Key("kcc.server.uri")
+	SessionHashKey  = attribute.Key("kcc.session.hash")
+	KCErrorKey      = attribute.Key("kcc.kcerror")
+	RequestSizeKey  = attribute.Key("kcc.request.size")
+	ResponseSizeKey = attribute.Key("kcc.response.size")
+)
+
+// A Tracing creates spans for SOAP requests.
+type Tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New creates a new Tracing with the provided tracer and propagator. If tracer
+// is nil, a tracer of the global otel TracerProvider is used. If propagator is
+// nil, the global otel TextMapPropagator is used.
+func New(tracer trace.Tracer, propagator propagation.TextMapPropagator) *Tracing {
+	if tracer == nil {
+		tracer = otel.Tracer(InstrumentationName)
+	}
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+
+	return &Tracing{
+		tracer:     tracer,
+		propagator: propagator,
+	}
+}
+
+// Interceptor returns a kcc.SOAPInterceptor which creates a span for every
+// request as child of the span found in the request context. The trace
+// context is propagated to the server with HTTP headers.
+func (t *Tracing) Interceptor(serverURI string) kcc.SOAPInterceptor {
+	return func(ctx context.Context, call *kcc.SOAPCall, payload *string, v interface{}, invoker kcc.SOAPInvoker) error {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		attributes := []attribute.KeyValue{
+			MethodKey.String(call.Method),
+			RequestSizeKey.Int(call.PayloadSize),
+		}
+		if serverURI != "" {
+			attributes = append(attributes, ServerURIKey.String(serverURI))
+		}
+		if call.SessionID != kcc.KCNoSessionID {
+			attributes = append(attributes, SessionHashKey.String(sessionHash(call.SessionID)))
+		}
+
+		ctx, span := t.tracer.Start(ctx, "kcc."+call.Method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attributes...),
+		)
+		defer span.End()
+
+		header := make(http.Header)
+		t.propagator.Inject(ctx, propagation.HeaderCarrier(header))
+		if len(header) > 0 {
+			ctx = kcc.ContextWithHTTPHeader(ctx, header)
+		}
+
+		err := invoker(ctx, payload, v)
+
+		span.SetAttributes(
+			ResponseSizeKey.Int(call.ResponseSize),
+			KCErrorKey.Int64(int64(call.Er)),
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else if call.Er != kcc.KCSuccess {
+			span.SetStatus(codes.Error, call.Er.Error())
+		}
+
+		return err
+	}
+}
+
+// InstrumentSOAPClient returns a kcc.SOAPClient which creates spans for all
+// requests of the provided client.
+func (t *Tracing) InstrumentSOAPClient(client kcc.SOAPClient) kcc.SOAPClient {
+	var serverURI string
+	switch c := client.(type) {
+	case *kcc.SOAPHTTPClient:
+		serverURI = c.URI
+	case *kcc.SOAPSocketClient:
+		serverURI = "file://" + c.Path
+	}
+
+	return kcc.ChainSOAPClient(client, t.Interceptor(serverURI))
+}
+
+// InstrumentKCC instruments the client of the provided kcc.KCC.
+func (t *Tracing) InstrumentKCC(c *kcc.KCC) {
+	c.Client = t.InstrumentSOAPClient(c.Client)
+}
+
+// sessionHash returns a short hash of the provided session ID, so spans can be
+// correlated by session without exposing the session ID itself.
+func sessionHash(sessionID kcc.KCSessionID) string {
+	sum := sha256.Sum256([]byte(strconv.FormatUint(uint64(sessionID), 10)))
+	return hex.EncodeToString(sum[:8])
+}
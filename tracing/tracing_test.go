@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"stash.kopano.io/kgol/kcc-go/v5"
+)
+
+func TestTracingPropagation(t *testing.T) {
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+		rw.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/"><SOAP-ENV:Body><ns:resolveUsernameResponse><er>0</er></ns:resolveUsernameResponse></SOAP-ENV:Body></SOAP-ENV:Envelope>`))
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := kcc.NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := kcc.NewKCCWithClient(client)
+	New(nil, propagation.TraceContext{}).InstrumentKCC(c)
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+		SpanID:     trace.SpanID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), parent)
+
+	if _, err = c.ResolveUsername(ctx, "user1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(traceparent, parent.TraceID().String()) {
+		t.Errorf("trace context not propagated, got traceparent %q", traceparent)
+	}
+}
+
+func TestSessionHash(t *testing.T) {
+	hash := sessionHash(1234)
+	if len(hash) != 16 {
+		t.Errorf("unexpected session hash length: %d", len(hash))
+	}
+	if strings.Contains(hash, "1234") || hash != sessionHash(1234) || hash == sessionHash(1235) {
+		t.Errorf("unexpected session hash: %s", hash)
+	}
+}
@@ -30,5 +30,10 @@ func (mt MAPIType) String() string {
 // Possible type values as defined in mapi4linux/include/mapidefs.h. We
 // only define the ones know and understood by kcc-go.
 const (
+	MAPI_STORE    MAPIType = 0x00000001
+	MAPI_FOLDER   MAPIType = 0x00000003
+	MAPI_ABCONT   MAPIType = 0x00000004
+	MAPI_MESSAGE  MAPIType = 0x00000005
 	MAPI_MAILUSER MAPIType = 0x00000006
+	MAPI_DISTLIST MAPIType = 0x00000008
 )
@@ -30,3 +30,12 @@ var DefaultUnixDialer = &net.Dialer{
 // DefaultUnixMaxConnections is the default maximum number of connections which
 // will be created to handle parallel SOAP requests to Unix sockets.
 var DefaultUnixMaxConnections = 20
+
+// DefaultUnixIdleConnTimeout is the default duration after which idle Unix
+// socket connections are closed.
+var DefaultUnixIdleConnTimeout = 90 * time.Second
+
+// DefaultUnixMaxStaleRetries is the default number of times a request is
+// retried when it failed on a reused Unix socket connection which was closed
+// by the server before any part of the request was written.
+var DefaultUnixMaxStaleRetries = 1
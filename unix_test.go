@@ -0,0 +1,341 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newStuckUnixSocket returns the path of a unix socket which accepts
+// connections but never responds.
+func newStuckUnixSocket(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "kcc-go-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "server.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			go ioutil.ReadAll(c)
+		}
+	}()
+
+	return path, func() {
+		listener.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSOAPSocketClientContext(t *testing.T) {
+	path, done := newStuckUnixSocket(t)
+	defer done()
+
+	client, err := NewSOAPSocketClient(&url.URL{Scheme: "file", Path: path}, &net.Dialer{
+		Timeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewKCCWithClient(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	started := time.Now()
+	_, err = c.ResolveUsername(ctx, "user1", 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled error, got %v", err)
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Errorf("request was not aborted on cancel")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.ResolveUsername(ctx, "user1", 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error, got %v", err)
+	}
+
+	_, err = c.ResolveUsername(ctx, "user1", 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error for done context, got %v", err)
+	}
+	if client.PoolSize() != 0 {
+		t.Errorf("aborted connections were not removed from pool: %d", client.PoolSize())
+	}
+}
+
+// newStaleUnixSocket returns the path of a unix socket which responds to the
+// first request of every connection only and closes the connection without
+// response on any further request.
+func newStaleUnixSocket(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "kcc-go-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "server.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	response := soapHeader + `<ns:resolveUsernameResponse><er>0</er><ulUserId>1</ulUserId></ns:resolveUsernameResponse>` + soapFooter
+	go func() {
+		for {
+			c, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for idx := 0; ; idx++ {
+					req, readErr := http.ReadRequest(r)
+					if readErr != nil {
+						return
+					}
+					io.Copy(ioutil.Discard, req.Body)
+					if idx > 0 {
+						return
+					}
+					fmt.Fprintf(c, "HTTP/1.1 200 OK\r\nContent-Type: text/xml; charset=utf-8\r\nContent-Length: %d\r\nConnection: keep-alive\r\n\r\n%s", len(response), response)
+				}
+			}(c)
+		}
+	}()
+
+	return path, func() {
+		listener.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSOAPSocketClientStaleConnection(t *testing.T) {
+	path, done := newStaleUnixSocket(t)
+	defer done()
+
+	client, err := NewSOAPSocketClient(&url.URL{Scheme: "file", Path: path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reuses []bool
+	client.OnConnReuse = func(reused bool) {
+		reuses = append(reuses, reused)
+	}
+	c := NewKCCWithClient(client)
+
+	resp, err := c.ResolveUsername(context.Background(), "user1", 1)
+	if err != nil || resp.ID != 1 || resp.Er != KCSuccess {
+		t.Fatalf("unexpected result %v %+v", err, resp)
+	}
+
+	// The server received the request, so it must not be sent again.
+	if _, err = c.ResolveUsername(context.Background(), "user1", 1); err == nil {
+		t.Errorf("expected error on stale connection after request was written")
+	}
+	if len(reuses) != 2 || reuses[0] || !reuses[1] {
+		t.Errorf("expected written request not to be retried, got reuses %v", reuses)
+	}
+
+	// Connections which fail before anything was written are retried.
+	reuses = nil
+	client.Pool = &testConnPool{path: path, failWrites: true}
+	for idx := 0; idx < 2; idx++ {
+		resp, err = c.ResolveUsername(context.Background(), "user1", 1)
+		if err != nil || resp.ID != 1 || resp.Er != KCSuccess {
+			t.Fatalf("request %d failed: %v %+v", idx, err, resp)
+		}
+	}
+	if len(reuses) != 3 || reuses[0] || !reuses[1] || reuses[2] {
+		t.Errorf("expected stale connection to be retried once, got reuses %v", reuses)
+	}
+}
+
+// A staleConn fails all writes once a response was read from it, as if the
+// server closed it while idle.
+type staleConn struct {
+	net.Conn
+	read int32
+}
+
+func (c *staleConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		atomic.StoreInt32(&c.read, 1)
+	}
+	return n, err
+}
+
+func (c *staleConn) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&c.read) != 0 {
+		return 0, syscall.EPIPE
+	}
+	return c.Conn.Write(p)
+}
+
+// A testConnPool dials connections to a unix socket and counts them. If
+// failWrites is set, the connections turn stale after their first response.
+type testConnPool struct {
+	path       string
+	failWrites bool
+	gets       int32
+	removes    int32
+}
+
+func (p *testConnPool) Get() (net.Conn, error) {
+	return p.GetWithTimeout(0)
+}
+
+func (p *testConnPool) GetWithTimeout(timeout time.Duration) (net.Conn, error) {
+	atomic.AddInt32(&p.gets, 1)
+	c, err := net.DialTimeout("unix", p.path, timeout)
+	if err != nil || !p.failWrites {
+		return c, err
+	}
+	return &staleConn{Conn: c}, nil
+}
+
+func (p *testConnPool) Close() error {
+	return nil
+}
+
+func (p *testConnPool) Remove(conn net.Conn) error {
+	atomic.AddInt32(&p.removes, 1)
+	return conn.Close()
+}
+
+func TestSOAPSocketClientPool(t *testing.T) {
+	path, done := newStaleUnixSocket(t)
+	defer done()
+
+	client, err := NewSOAPSocketClient(&url.URL{Scheme: "file", Path: "/nonexistent.sock"}, &net.Dialer{
+		Timeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := &testConnPool{path: path}
+	client.Pool = pool
+
+	resp, err := NewKCCWithClient(client).ResolveUsername(context.Background(), "user1", 1)
+	if err != nil || resp.ID != 1 {
+		t.Fatalf("unexpected result %v %+v", err, resp)
+	}
+	client.Transport.CloseIdleConnections()
+	if atomic.LoadInt32(&pool.gets) != 1 || atomic.LoadInt32(&pool.removes) != 1 || client.PoolSize() != 0 {
+		t.Errorf("connection was not taken from and removed from pool: %d gets, %d removes", pool.gets, pool.removes)
+	}
+}
+
+func TestSOAPSocketClientSlowResponse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kcc-go-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "server.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go http.Serve(listener, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(rw, testSOAPResponse(testResolveUsernameResponse))
+	}))
+
+	client, err := NewSOAPSocketClient(&url.URL{Scheme: "file", Path: path}, &net.Dialer{
+		Timeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := NewKCCWithClient(client).ResolveUsername(context.Background(), "user1", 1)
+	if err != nil || resp.ID != 42 {
+		t.Errorf("slow response failed: %v %+v", err, resp)
+	}
+}
+
+// A blockingConnPool blocks in GetWithTimeout until release is closed.
+type blockingConnPool struct {
+	testConnPool
+	release chan struct{}
+}
+
+func (p *blockingConnPool) GetWithTimeout(timeout time.Duration) (net.Conn, error) {
+	<-p.release
+	return p.testConnPool.GetWithTimeout(timeout)
+}
+
+func TestSOAPSocketClientPoolContext(t *testing.T) {
+	path, done := newStaleUnixSocket(t)
+	defer done()
+
+	client, err := NewSOAPSocketClient(&url.URL{Scheme: "file", Path: path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := &blockingConnPool{testConnPool: testConnPool{path: path}, release: make(chan struct{})}
+	client.Pool = pool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if _, err = NewKCCWithClient(client).ResolveUsername(ctx, "user1", 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error, got %v", err)
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Errorf("waiting for pooled connection was not aborted")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err = getPoolConn(ctx, pool, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled error, got %v", err)
+	}
+	removes := atomic.LoadInt32(&pool.removes)
+	close(pool.release)
+	for idx := 0; idx < 100 && atomic.LoadInt32(&pool.removes) == removes; idx++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&pool.removes) == removes {
+		t.Errorf("connection returned after abort was not removed from pool")
+	}
+}